@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -13,6 +14,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	"github.com/rddl-network/energy-service/internal/model"
 )
 
 func main() {
@@ -29,7 +33,8 @@ func main() {
 	production := flag.Bool("production", false, "Use for production purposes")
 	date := flag.String("date", currentDate, "Date in YYYY-MM-DD format")
 	tzName := flag.String("timezone", "", "Timezone name (e.g., Europe/Vienna). If empty, uses system timezone or UTC.")
-	flag.StringVar(&dataStr, "data", defaultData, "96 float value to be sent in the JSON payload")
+	keyHex := flag.String("key", "", "Hex encoded secp256k1 private key of the device used to sign the report")
+	flag.StringVar(&dataStr, "data", defaultData, "96 float values (92 or 100 on daylight saving days) to be sent in the JSON payload")
 
 	flag.Parse()
 
@@ -51,6 +56,13 @@ func main() {
 		}
 	}
 
+	// One timestamp per 15 minute interval of the local day (92, 96 or 100)
+	timestamps, err := model.IntervalStarts(*date, tz)
+	if err != nil {
+		log.Fatalf("Invalid date or timezone: %v", err)
+	}
+	intervals := len(timestamps)
+
 	strValues := strings.Fields(dataStr)
 	// Create a slice to hold the float values
 	dataSlice := make([]float64, 0, len(strValues))
@@ -69,35 +81,33 @@ func main() {
 	if !*production {
 		if dataStr == defaultData {
 			generateRandomData = true
-		} else if len(dataSlice) != 96 {
-			log.Fatalf("Expected 96 values, got %d", len(dataSlice))
+		} else if len(dataSlice) != intervals {
+			log.Fatalf("Expected %d values, got %d", intervals, len(dataSlice))
 		}
 	} else {
-		// Ensure we have exactly 96 values
-		if len(dataSlice) != 96 {
-			log.Fatalf("Expected 96 values, got %d", len(dataSlice))
+		// Ensure we have exactly one value per interval
+		if len(dataSlice) != intervals {
+			log.Fatalf("Expected %d values, got %d", intervals, len(dataSlice))
 		}
 	}
 
 	// Prepare data array of objects with value and timestamp
-	var dataArray [96]map[string]interface{}
-	baseTime, _ := time.ParseInLocation("2006-01-02", *date, time.UTC)
-	for i := 0; i < 96; i++ {
+	dataArray := make([]model.EnergyTuple, intervals)
+	for i := 0; i < intervals; i++ {
 		var val float64
 		if generateRandomData {
 			if i == 0 {
 				val = rand.Float64()
 			} else {
-				val = dataArray[i-1]["value"].(float64) + rand.Float64()
+				val = dataArray[i-1].Value + rand.Float64()
 			}
 		} else {
 			val = dataSlice[i]
 		}
-		// Each 15 minutes
-		ts := baseTime.Add(time.Duration(i*15) * time.Minute).UTC().Format("2006-01-02 15:04:05")
-		dataArray[i] = map[string]interface{}{
-			"value":     val,
-			"timestamp": ts,
+		// Each timestamp marks the start of its 15 minute interval
+		dataArray[i] = model.EnergyTuple{
+			Value:     val,
+			Timestamp: model.TimeStamp(timestamps[i]),
 		}
 	}
 
@@ -105,12 +115,12 @@ func main() {
 	url := fmt.Sprintf("%s://%s:%s/api/energy", *protocol, *host, *port)
 
 	// Create the JSON payload
-	payload := map[string]interface{}{
-		"version":       1,
-		"id":            *id,
-		"date":          *date,
-		"timezone_name": tz,
-		"data":          dataArray,
+	payload := model.EnergyData{
+		Version:      1,
+		ID:           *id,
+		Date:         *date,
+		TimezoneName: tz,
+		Data:         dataArray,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -119,6 +129,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Sign the serialized report with the device key
+	if *keyHex != "" {
+		jsonData, err = signPayload(jsonData, *keyHex)
+		if err != nil {
+			log.Fatalf("Failed to sign payload: %v", err)
+		}
+	}
+
 	// Send the HTTP POST request
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -141,3 +159,17 @@ func main() {
 	// Print the response
 	fmt.Printf("Response from server: %s\n", string(body))
 }
+
+// signPayload signs the serialized report with a hex encoded secp256k1 private key and appends the signature
+func signPayload(payload []byte, keyHex string) ([]byte, error) {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, err
+	}
+	privKey := &secp256k1.PrivKey{Key: key}
+	signature, err := privKey.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	return model.AppendSignature(payload, hex.EncodeToString(signature))
+}
@@ -2,43 +2,198 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"time"
 
-	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/planetmint/planetmint-go/app"
+	"github.com/planetmint/planetmint-go/lib"
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/model"
+	"github.com/rddl-network/energy-service/internal/planetmint"
 )
 
+const usage = `Usage: energy-db [flags] [command] [arguments]
+
+Commands:
+  dump                        export all keys to the --out JSON file (default)
+  list devices                print all devices
+  get <id>                    print a device with its meter resets and history
+  reports <id> [--from DATE] [--to DATE]
+                              print the report records of a device
+  delete-report <id> <date>   delete the report record of a device for a date
+                              and drop the cached last reading of the device
+  set-key <id> <public-key>   register the hex encoded public key that verifies the reports of a device
+  import <json>               store the devices of a JSON file as printed by "list devices"
+  compact                     compact the database
+  verify                      check that all keys and values match the key schema
+  reconcile [--fix] [--device-type TYPE] [id...]
+                              compare the devices and the given IDs with their DERs on Planetmint
+  restore --in <archive>      restore a backup from GET /admin/backup into an empty directory
+
+Read commands open the database read-only and don't migrate it; except for dump
+and verify they fail on a store that needs migration. Commands that write need
+exclusive access, stop the energy-service first.
+
+Flags:
+`
+
 func main() {
-	dbDir := flag.String("db", "", "Path to the LevelDB database directory")
-	outFile := flag.String("out", "output.json", "Output JSON file")
+	configFile := flag.String("config", "app.toml", "Path to the energy-service configuration, used for the database settings")
+	dbDir := flag.String("db", "", "Path to the LevelDB database directory (default: path from the [database] section of the config)")
+	outFile := flag.String("out", "output.json", "Output JSON file of the dump command")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "List the schema migrations the energy-service would apply to the database and exit")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	if *dbDir == "" {
-		log.Fatal("Please provide the path to the LevelDB database directory using --db")
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	dbConfig := cfg.Database
+	if dbConfig.Driver != "" && dbConfig.Driver != database.DriverLevelDB {
+		log.Fatalf("energy-db only reads LevelDB stores, use the %s tools for the configured %s store", dbConfig.Driver, dbConfig.Driver)
+	}
+	if *dbDir != "" {
+		dbConfig.Path = *dbDir
 	}
 
-	db, err := leveldb.OpenFile(*dbDir, nil)
+	if *migrateDryRun {
+		migrationDryRun(dbConfig)
+		return
+	}
+
+	command, args := "dump", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "dump":
+		dump(dbConfig, *outFile)
+	case "list":
+		if len(args) != 1 || args[0] != "devices" {
+			usageError("list takes the argument devices")
+		}
+		listDevices(dbConfig)
+	case "get":
+		if len(args) != 1 {
+			usageError("get takes a device ID")
+		}
+		getDevice(dbConfig, args[0])
+	case "reports":
+		reports(dbConfig, args)
+	case "delete-report":
+		if len(args) != 2 {
+			usageError("delete-report takes a device ID and a date")
+		}
+		deleteReport(dbConfig, args[0], args[1])
+	case "set-key":
+		if len(args) != 2 {
+			usageError("set-key takes a device ID and a public key")
+		}
+		setKey(dbConfig, args[0], args[1])
+	case "import":
+		if len(args) != 1 {
+			usageError("import takes a JSON file")
+		}
+		importDevices(dbConfig, args[0])
+	case "compact":
+		compact(dbConfig)
+	case "verify":
+		verify(dbConfig)
+	case "reconcile":
+		reconcile(cfg, dbConfig, args)
+	case "restore":
+		restore(dbConfig, args)
+	default:
+		usageError(fmt.Sprintf("unknown command %q", command))
+	}
+}
+
+func usageError(msg string) {
+	fmt.Fprintf(os.Stderr, "energy-db: %s\n\n", msg)
+	flag.Usage()
+	os.Exit(2)
+}
+
+// openReadOnly opens the database read-only so inspecting a store can never modify it.
+// Pending schema migrations are not applied, so only commands that read the raw keys may open
+// an older store.
+func openReadOnly(dbConfig config.DatabaseConfig, raw bool) *database.Database {
+	db, err := database.NewReadOnlyDatabase(dbConfig)
 	if err != nil {
+		log.Fatalf("Failed to open LevelDB (stop the energy-service or inspect a copy if the database is locked): %v", err)
+	}
+	if raw {
+		return db
+	}
+	if err := db.CheckSchema(); err != nil {
+		db.Close()
+		if errors.Is(err, database.ErrNeedsMigration) {
+			log.Fatalf("%v (start the energy-service or run a writing command such as compact to migrate it, --migrate-dry-run shows the changes)", err)
+		}
 		log.Fatalf("Failed to open LevelDB: %v", err)
 	}
-	defer db.Close()
+	return db
+}
+
+// openWritable opens the database for writing, which applies pending schema migrations.
+// Only import may create a new database.
+func openWritable(dbConfig config.DatabaseConfig, create bool) *database.Database {
+	if _, err := os.Stat(dbConfig.Path); err != nil && !create {
+		log.Fatalf("Failed to open LevelDB: %v", err)
+	}
+	db, err := database.NewDatabase(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to open LevelDB (stop the energy-service if the database is locked): %v", err)
+	}
+	return db
+}
 
-	iter := db.NewIterator(nil, nil)
-	defer iter.Release()
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("Failed to encode JSON: %v", err)
+	}
+}
 
-	entries := make(map[string]string)
-	for iter.Next() {
-		key := string(iter.Key())
-		value := string(iter.Value())
-		entries[key] = value
+func migrationDryRun(dbConfig config.DatabaseConfig) {
+	results, err := database.DryRunMigrations(dbConfig)
+	if err != nil {
+		log.Fatalf("Migration dry run failed: %v", err)
+	}
+	if len(results) == 0 {
+		fmt.Println("Database schema is up to date")
 	}
-	if err := iter.Error(); err != nil {
+	for _, result := range results {
+		fmt.Printf("Migration %d: %s (%d keys)\n", result.Version, result.Description, result.Keys)
+	}
+}
+
+// dump exports every key of the store as a flat JSON map
+func dump(dbConfig config.DatabaseConfig, outFile string) {
+	db := openReadOnly(dbConfig, true)
+	defer db.Close()
+
+	entries := make(map[string]string)
+	err := db.Iterate(func(key, value []byte) error {
+		entries[string(key)] = string(value)
+		return nil
+	})
+	if err != nil {
 		log.Fatalf("Iterator error: %v", err)
 	}
 
-	file, err := os.Create(*outFile)
+	file, err := os.Create(outFile)
 	if err != nil {
 		log.Fatalf("Failed to create output file: %v", err)
 	}
@@ -50,5 +205,234 @@ func main() {
 		log.Fatalf("Failed to encode JSON: %v", err)
 	}
 
-	fmt.Printf("Exported %d entries to %s\n", len(entries), *outFile)
+	fmt.Printf("Exported %d entries to %s\n", len(entries), outFile)
+}
+
+func listDevices(dbConfig config.DatabaseConfig) {
+	db := openReadOnly(dbConfig, false)
+	defer db.Close()
+
+	devices, err := db.GetAllDevices()
+	if err != nil {
+		log.Fatalf("Failed to list devices: %v", err)
+	}
+	printJSON(devices)
+}
+
+func getDevice(dbConfig config.DatabaseConfig, zigbeeID string) {
+	db := openReadOnly(dbConfig, false)
+	defer db.Close()
+
+	device, found, err := db.GetDevice(zigbeeID)
+	if err != nil {
+		log.Fatalf("Failed to get device: %v", err)
+	}
+	if !found {
+		log.Fatalf("Device %s not found", zigbeeID)
+	}
+	resets, err := db.GetMeterResets(zigbeeID)
+	if err != nil {
+		log.Fatalf("Failed to get meter resets: %v", err)
+	}
+	history, err := db.GetDeviceHistory(zigbeeID)
+	if err != nil {
+		log.Fatalf("Failed to get device history: %v", err)
+	}
+	printJSON(struct {
+		ZigbeeID    string                  `json:"zigbee_id"`
+		Device      database.Device         `json:"device"`
+		MeterResets []database.MeterReset   `json:"meter_resets"`
+		History     []database.DeviceChange `json:"history"`
+	}{zigbeeID, device, resets, history})
+}
+
+func reports(dbConfig config.DatabaseConfig, args []string) {
+	if len(args) == 0 {
+		usageError("reports takes a device ID")
+	}
+	zigbeeID := args[0]
+	fs := flag.NewFlagSet("reports", flag.ExitOnError)
+	from := fs.String("from", "", "First date (YYYY-MM-DD, default: first report)")
+	to := fs.String("to", "9999-12-31", "Last date (YYYY-MM-DD)")
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatalf("Failed to parse arguments: %v", err)
+	}
+	for _, date := range []string{*from, *to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			usageError(fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", date))
+		}
+	}
+
+	db := openReadOnly(dbConfig, false)
+	defer db.Close()
+
+	records, err := db.GetReportRecords(zigbeeID, *from, *to)
+	if err != nil {
+		log.Fatalf("Failed to get reports: %v", err)
+	}
+	printJSON(records)
+}
+
+func deleteReport(dbConfig config.DatabaseConfig, zigbeeID, date string) {
+	db := openWritable(dbConfig, false)
+	defer db.Close()
+
+	found, err := db.DeleteReport(zigbeeID, date)
+	if err != nil {
+		log.Fatalf("Failed to delete report: %v", err)
+	}
+	if !found {
+		log.Fatalf("No report of device %s for %s", zigbeeID, date)
+	}
+	fmt.Printf("Deleted report of device %s for %s\n", zigbeeID, date)
+}
+
+// setKey registers the public key of a device, it has to derive to the Planetmint address of the device
+func setKey(dbConfig config.DatabaseConfig, zigbeeID, publicKey string) {
+	address, err := model.PlanetmintAddress(publicKey)
+	if err != nil {
+		log.Fatalf("Invalid public key: %v", err)
+	}
+
+	db := openWritable(dbConfig, false)
+	defer db.Close()
+	device, found, err := db.GetDevice(zigbeeID)
+	if err != nil {
+		log.Fatalf("Failed to read device: %v", err)
+	}
+	if !found {
+		log.Fatalf("Device %s not found", zigbeeID)
+	}
+	if device.PlanetmintAddress != address {
+		log.Fatalf("Public key belongs to %s, device %s has the Planetmint address %s", address, zigbeeID, device.PlanetmintAddress)
+	}
+	if _, err := db.UpdateDevice(zigbeeID, "", "", "", "", publicKey, "energy-db set-key"); err != nil {
+		log.Fatalf("Failed to set public key: %v", err)
+	}
+	fmt.Printf("Set public key of device %s\n", zigbeeID)
+}
+
+// importDevices stores the devices of a JSON file in the format printed by "list devices",
+// existing devices with the same ID are replaced
+func importDevices(dbConfig config.DatabaseConfig, file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", file, err)
+	}
+	var devices map[string]database.Device
+	if err := json.Unmarshal(data, &devices); err != nil {
+		log.Fatalf("Failed to decode devices: %v", err)
+	}
+
+	ids := make([]string, 0, len(devices))
+	for id := range devices {
+		if id == "" {
+			log.Fatalf("Device with empty ID in %s", file)
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	db := openWritable(dbConfig, true)
+	defer db.Close()
+	for _, id := range ids {
+		if err := db.PutDevice(id, devices[id]); err != nil {
+			log.Fatalf("Failed to import device %s: %v", id, err)
+		}
+	}
+	fmt.Printf("Imported %d devices\n", len(ids))
+}
+
+func compact(dbConfig config.DatabaseConfig) {
+	db := openWritable(dbConfig, false)
+	defer db.Close()
+
+	if err := db.Compact(); err != nil {
+		log.Fatalf("Compaction failed: %v", err)
+	}
+	fmt.Println("Compacted", dbConfig.Path)
+}
+
+func verify(dbConfig config.DatabaseConfig) {
+	db := openReadOnly(dbConfig, true)
+	problems, err := db.Verify()
+	db.Close()
+	if err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("Found %d problems\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Println("No problems found")
+}
+
+// reconcile compares the local devices and the given IDs with their DERs and optionally fixes mismatches
+func reconcile(cfg *config.Config, dbConfig config.DatabaseConfig, args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "Register missing DERs, store devices missing locally and take over the addresses of the DER")
+	deviceType := fs.String("device-type", "", "Device type of devices stored from a DER, they are only reported without it")
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("Failed to parse arguments: %v", err)
+	}
+
+	libConfig := lib.GetConfig()
+	libConfig.SetEncodingConfig(app.MakeEncodingConfig())
+	libConfig.SetChainID(cfg.Planetmint.ChainID)
+	grpcConn, err := planetmint.SetupGRPCConnection(cfg)
+	if err != nil {
+		log.Fatalf("Connection to Planetmint failed: %v", err)
+	}
+	defer grpcConn.Close()
+	client := planetmint.NewPlanetmintClient(cfg.Planetmint.Actor, grpcConn)
+
+	var db *database.Database
+	if *fix {
+		db = openWritable(dbConfig, false)
+	} else {
+		db = openReadOnly(dbConfig, false)
+	}
+	defer db.Close()
+
+	mismatches, err := planetmint.Reconcile(db, client, planetmint.ReconcileOptions{
+		Fix:        *fix,
+		IDs:        fs.Args(),
+		DeviceType: *deviceType,
+		ChangedBy:  "energy-db reconcile",
+	})
+	if mismatches == nil {
+		mismatches = []planetmint.Mismatch{}
+	}
+	printJSON(mismatches)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+}
+
+// restore loads a backup archive from GET /admin/backup into an empty database directory
+func restore(dbConfig config.DatabaseConfig, args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	inFile := fs.String("in", "", "Backup archive to restore (required)")
+	dbDir := fs.String("db", dbConfig.Path, "Empty or missing directory to restore the LevelDB database into")
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("Failed to parse arguments: %v", err)
+	}
+	if *inFile == "" {
+		usageError("restore takes a backup archive with --in")
+	}
+
+	file, err := os.Open(*inFile)
+	if err != nil {
+		log.Fatalf("Failed to open backup archive: %v", err)
+	}
+	defer file.Close()
+
+	entries, err := database.Restore(file, config.DatabaseConfig{Path: *dbDir})
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	fmt.Printf("Restored %d entries to %s\n", entries, *dbDir)
 }
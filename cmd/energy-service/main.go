@@ -8,7 +8,6 @@ import (
 	"github.com/planetmint/planetmint-go/app"
 	"github.com/planetmint/planetmint-go/lib"
 	"github.com/rddl-network/energy-service/internal/config"
-	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/influxdb"
 	"github.com/rddl-network/energy-service/internal/planetmint"
 	"github.com/rddl-network/energy-service/internal/server"
@@ -57,6 +56,24 @@ func init() {
 	libConfig.SetEncodingConfig(encodingConfig)
 }
 
+// checkInfluxDB verifies connectivity, bucket and org with a test query
+func checkInfluxDB(client influxdb2.Client, cfg config.InfluxDBConfig) {
+	// Simple test query: list measurements in the bucket
+	testQuery := influxdb.MeasurementsQuery(cfg.Bucket)
+	queryAPI := client.QueryAPI(cfg.Org)
+	result, err := queryAPI.Query(context.Background(), testQuery)
+	if err != nil {
+		log.Fatalf("InfluxDB test query failed: %v", err)
+	}
+	log.Println("InfluxDB connectivity and test query succeeded. Measurements:")
+	for result.Next() {
+		log.Println(result.Record().Value())
+	}
+	if result.Err() != nil {
+		log.Fatalf("InfluxDB test query result error: %v", result.Err())
+	}
+}
+
 func main() {
 	// Create templates
 	writeContentToFiles()
@@ -69,10 +86,23 @@ func main() {
 
 	// Access configuration
 	log.Printf("Server running on port: %d", cfg.Server.Port)
-	log.Printf("InfluxDB URL: %s", cfg.InfluxDB.URL)
-	client := influxdb2.NewClient(cfg.InfluxDB.URL, cfg.InfluxDB.Token)
-	defer client.Close() // Ensure client is closed properly
-	influxClient := influxdb.NewLocalInfluxClient(client, cfg.InfluxDB.Org, cfg.InfluxDB.Bucket)
+	var influxClient influxdb.Client
+	switch cfg.InfluxDB.Backend {
+	case "", config.BackendInfluxDB:
+		log.Printf("InfluxDB URL: %s", cfg.InfluxDB.URL)
+		client := influxdb2.NewClient(cfg.InfluxDB.URL, cfg.InfluxDB.Token)
+		defer client.Close() // Ensure client is closed properly
+		checkInfluxDB(client, cfg.InfluxDB)
+		influxClient = influxdb.NewLocalInfluxClient(client, cfg.InfluxDB.Org, cfg.InfluxDB.Bucket)
+	case config.BackendMemory:
+		log.Printf("Using the in-memory time-series backend, file: %q", cfg.InfluxDB.MemoryFile)
+		influxClient, err = influxdb.NewMemoryClient(cfg.InfluxDB.MemoryFile)
+		if err != nil {
+			log.Fatalf("Failed to open the in-memory time-series backend: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown time-series backend %q, expected %s or %s", cfg.InfluxDB.Backend, config.BackendInfluxDB, config.BackendMemory)
+	}
 
 	libConfig.SetChainID(cfg.Planetmint.ChainID)
 	grpcConn, err := planetmint.SetupGRPCConnection(cfg)
@@ -81,12 +111,8 @@ func main() {
 	}
 	plmntClient := planetmint.NewPlanetmintClient(cfg.Planetmint.Actor, grpcConn)
 
-	// Create and configure server
-	db, err := database.NewDatabase()
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
-	}
-	srv, err := server.NewServer(plmntClient, influxClient, db)
+	// Create and configure server, the database and the outbox are opened before MQTT subscribes
+	srv, err := server.NewDefaultServer(plmntClient, influxClient)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
@@ -95,23 +121,6 @@ func main() {
 	mux := http.NewServeMux()
 	srv.Routes(mux)
 
-	// Connectivity check: simple test query to verify bucket/org
-	// Simple test query: list measurements in the bucket
-	testQuery := `import "influxdata/influxdb/schema"
-schema.measurements(bucket: "` + cfg.InfluxDB.Bucket + `")`
-	queryAPI := client.QueryAPI(cfg.InfluxDB.Org)
-	result, err := queryAPI.Query(context.Background(), testQuery)
-	if err != nil {
-		log.Fatalf("InfluxDB test query failed: %v", err)
-	}
-	log.Println("InfluxDB connectivity and test query succeeded. Measurements:")
-	for result.Next() {
-		log.Println(result.Record().Value())
-	}
-	if result.Err() != nil {
-		log.Fatalf("InfluxDB test query result error: %v", result.Err())
-	}
-
 	// Start the server
 	log.Println("Server starting on http://localhost:" + strconv.Itoa(cfg.Server.Port))
 	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(cfg.Server.Port), mux))
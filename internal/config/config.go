@@ -9,10 +9,41 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Server     ServerConfig     `toml:"server"`
-	InfluxDB   InfluxDBConfig   `toml:"influxdb"`
-	Planetmint PlanetmintConfig `toml:"planetmint"`
-	MQTT       MQTTConfig       `toml:"mqtt"`
+	Server      ServerConfig                `toml:"server"`
+	InfluxDB    InfluxDBConfig              `toml:"influxdb"`
+	Planetmint  PlanetmintConfig            `toml:"planetmint"`
+	MQTT        MQTTConfig                  `toml:"mqtt"`
+	Database    DatabaseConfig              `toml:"database"`
+	Outbox      OutboxConfig                `toml:"outbox"`
+	DeviceTypes map[string]DeviceTypeConfig `toml:"device-types"` // Catalog of device types, device types are not validated if empty
+}
+
+// DeviceTypeConfig holds the plausibility limits of a device type, a zero limit is not enforced.
+// Limits have to be written as TOML floats (e.g. 50.0).
+type DeviceTypeConfig struct {
+	MaxPowerKW        float64 `toml:"max-power-kw"`         // Maximum power, limits the energy per 15 minute interval to max-power-kw/4
+	MaxDailyEnergyKWh float64 `toml:"max-daily-energy-kwh"` // Maximum energy per day
+	ExportAllowed     bool    `toml:"export-allowed"`       // Whether the device may feed energy into the grid
+}
+
+// DatabaseConfig holds the device store configuration, a zero size uses the LevelDB default
+type DatabaseConfig struct {
+	Driver                string `toml:"driver"`                   // Device store: leveldb, sqlite or postgres
+	DSN                   string `toml:"dsn"`                      // SQLite file or PostgreSQL connection string of the SQL drivers
+	Path                  string `toml:"path"`                     // Path to the LevelDB directory
+	CacheSizeMB           int    `toml:"cache-size-mb"`            // Block cache size in MiB (default 8)
+	WriteBufferMB         int    `toml:"write-buffer-mb"`          // Size of the in-memory table before it is flushed to disk in MiB (default 4)
+	CompactionTableSizeMB int    `toml:"compaction-table-size-mb"` // Size of the tables written by compaction in MiB (default 2)
+	CompactionL0Trigger   int    `toml:"compaction-l0-trigger"`    // Number of level-0 tables that triggers a compaction (default 4)
+	SyncWrites            bool   `toml:"sync-writes"`              // fsync every write, slower but no data loss on power failure
+}
+
+// OutboxConfig holds the configuration of the queue of InfluxDB writes
+type OutboxConfig struct {
+	Path            string `toml:"path"`              // Path to the LevelDB directory of the queue, empty writes to InfluxDB directly
+	RetryMinSeconds int    `toml:"retry-min-seconds"` // Delay before retrying a failed write, doubled on every further failure (default 5)
+	RetryMaxSeconds int    `toml:"retry-max-seconds"` // Upper limit of the retry delay (default 300)
+	MaxAttempts     int    `toml:"max-attempts"`      // Failed writes of an item before it is moved to the dead letters (default 10)
 }
 
 // MQTTConfig holds MQTT-related configuration
@@ -25,27 +56,46 @@ type MQTTConfig struct {
 }
 
 type PlanetmintConfig struct {
-	Actor   string `toml:"actor"`
-	ChainID string `toml:"chain-id"`
-	RPCHost string `toml:"rpc-host"`
+	Actor                    string `toml:"actor"`
+	ChainID                  string `toml:"chain-id"`
+	RPCHost                  string `toml:"rpc-host"`
+	ReconcileIntervalMinutes int    `toml:"reconcile-interval-minutes"` // Interval of the reconciliation of devices and DERs, 0 disables it
+	ReconcileFix             bool   `toml:"reconcile-fix"`              // Register missing DERs and take over DER addresses instead of only logging mismatches
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port     int    `toml:"port"`      // Port for the HTTP server
-	LogLevel string `toml:"log-level"` // Log level: debug, info, warn, error
-	DataFile string `toml:"data-file"` // Path to the data file
-	Password string `toml:"password"`  // Optional: password for protected endpoints
+	Port                 int    `toml:"port"`                   // Port for the HTTP server
+	LogLevel             string `toml:"log-level"`              // Log level: debug, info, warn, error
+	DataFile             string `toml:"data-file"`              // Path to the data file
+	Password             string `toml:"password"`               // Optional: password for protected endpoints
+	RequireSignedReports bool   `toml:"require-signed-reports"` // Reject energy reports of devices without a registered public key (default true), false accepts them as unsigned
 }
 
 // InfluxDBConfig holds InfluxDB-related configuration
 type InfluxDBConfig struct {
-	URL    string `toml:"url"`    // InfluxDB URL
-	Token  string `toml:"token"`  // InfluxDB authentication token
-	Org    string `toml:"org"`    // InfluxDB organization
-	Bucket string `toml:"bucket"` // InfluxDB bucket
+	Backend     string `toml:"backend"`      // Time-series backend: influxdb or memory (for development, no InfluxDB needed)
+	MemoryFile  string `toml:"memory-file"`  // Optional: file the memory backend keeps its points in, empty keeps them in memory only
+	URL         string `toml:"url"`          // InfluxDB URL
+	Token       string `toml:"token"`        // InfluxDB authentication token
+	Org         string `toml:"org"`          // InfluxDB organization
+	Bucket      string `toml:"bucket"`       // InfluxDB bucket
+	FieldSchema string `toml:"field-schema"` // Energy field names: legacy (kW/h), canonical (energy_kwh) or dual (both)
 }
 
+// Time-series backends
+const (
+	BackendInfluxDB = "influxdb"
+	BackendMemory   = "memory"
+)
+
+// InfluxDB field schemas
+const (
+	FieldSchemaLegacy    = "legacy"
+	FieldSchemaCanonical = "canonical"
+	FieldSchemaDual      = "dual"
+)
+
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
@@ -53,12 +103,16 @@ func DefaultConfig() *Config {
 			LogLevel: "info",
 			DataFile: "energy_data.json",
 			// Password: no default, must be set in config file
+			RequireSignedReports: true,
 		},
 		InfluxDB: InfluxDBConfig{
-			URL:    "http://localhost:8086",
-			Token:  "",
-			Org:    "",
-			Bucket: "",
+			Backend: BackendInfluxDB,
+			URL:     "http://localhost:8086",
+			Token:   "",
+			Org:     "",
+			Bucket:  "",
+			// write both field names until all dashboards moved to energy_kwh
+			FieldSchema: FieldSchemaDual,
 		},
 		Planetmint: PlanetmintConfig{
 			Actor:   "plmnt17keyseuam6qz4t49lg0e75a8y7jvcj03fn635z",
@@ -72,6 +126,16 @@ func DefaultConfig() *Config {
 			Password: "",
 			Topic:    "energy-consumption-reports",
 		},
+		Database: DatabaseConfig{
+			Driver: "leveldb",
+			Path:   "devices.db",
+		},
+		Outbox: OutboxConfig{
+			Path:            "outbox.db",
+			RetryMinSeconds: 5,
+			RetryMaxSeconds: 300,
+			MaxAttempts:     10,
+		},
 	}
 }
 
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+func TestDeviceTypeCatalog(t *testing.T) {
+	data := []byte(`
+[device-types.plug]
+max-power-kw = 3.6
+max-daily-energy-kwh = 50.0
+
+[device-types.pv-inverter]
+max-power-kw = 10.0
+export-allowed = true
+`)
+	cfg := DefaultConfig()
+	if err := toml.Unmarshal(data, cfg); err != nil {
+		t.Fatalf("failed to unmarshal config: %v", err)
+	}
+	if len(cfg.DeviceTypes) != 2 {
+		t.Fatalf("expected 2 device types, got %d", len(cfg.DeviceTypes))
+	}
+	plug := cfg.DeviceTypes["plug"]
+	if plug.MaxPowerKW != 3.6 || plug.MaxDailyEnergyKWh != 50 || plug.ExportAllowed {
+		t.Errorf("unexpected plug limits: %+v", plug)
+	}
+	if !cfg.DeviceTypes["pv-inverter"].ExportAllowed {
+		t.Error("expected pv-inverter to allow export")
+	}
+}
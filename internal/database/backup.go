@@ -0,0 +1,136 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+
+	"github.com/rddl-network/energy-service/internal/config"
+)
+
+// backupMagic starts every backup archive. An archive is a gzip stream of the magic
+// followed by uvarint length-prefixed key and value pairs in key order.
+const backupMagic = "energy-service-backup v1\n"
+
+// restoreBatchSize is the number of entries written per batch during a restore
+const restoreBatchSize = 1000
+
+// Backup writes a consistent snapshot of the store as a compressed archive to w and
+// returns the number of entries. The store stays available for reads and writes.
+func (db *Database) Backup(w io.Writer) (int, error) {
+	snapshot, err := db.db.GetSnapshot()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create snapshot: %v", err)
+	}
+	defer snapshot.Release()
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	if _, err := bw.WriteString(backupMagic); err != nil {
+		return 0, err
+	}
+
+	entries := 0
+	iter := snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := writeBackupField(bw, iter.Key()); err != nil {
+			return entries, err
+		}
+		if err := writeBackupField(bw, iter.Value()); err != nil {
+			return entries, err
+		}
+		entries++
+	}
+	if err := iter.Error(); err != nil {
+		return entries, fmt.Errorf("iterator error: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return entries, err
+	}
+	return entries, zw.Close()
+}
+
+func writeBackupField(w *bufio.Writer, field []byte) error {
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(field)))
+	if _, err := w.Write(length[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(field)
+	return err
+}
+
+func readBackupField(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	field := make([]byte, length)
+	_, err = io.ReadFull(r, field)
+	return field, err
+}
+
+// Restore loads a backup archive into a new LevelDB store at cfg.Path and returns the number
+// of entries. The directory must not exist or be empty. Schema migrations run when the
+// restored store is opened.
+func Restore(r io.Reader, cfg config.DatabaseConfig) (int, error) {
+	files, err := os.ReadDir(cfg.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if len(files) > 0 {
+		return 0, fmt.Errorf("restore target %s is not empty", cfg.Path)
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("invalid backup archive: %v", err)
+	}
+	br := bufio.NewReader(zr)
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != backupMagic {
+		return 0, errors.New("invalid backup archive: missing header")
+	}
+
+	db, err := leveldb.OpenFile(cfg.Path, &opt.Options{ErrorIfExist: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create database %s: %v", cfg.Path, err)
+	}
+	defer db.Close()
+
+	entries := 0
+	batch := new(leveldb.Batch)
+	for {
+		key, err := readBackupField(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, fmt.Errorf("invalid backup archive: %v", err)
+		}
+		value, err := readBackupField(br)
+		if err != nil {
+			return entries, fmt.Errorf("invalid backup archive: %v", err)
+		}
+		batch.Put(key, value)
+		entries++
+		if batch.Len() == restoreBatchSize {
+			if err := db.Write(batch, nil); err != nil {
+				return entries, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
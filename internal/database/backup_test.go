@@ -0,0 +1,72 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rddl-network/energy-service/internal/config"
+)
+
+func TestBackupRestore(t *testing.T) {
+	db, err := NewDatabase(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.AddDevice("dev1", "liq1", "Plug", "plug", "plmnt1", ""))
+	require.NoError(t, db.SetReportRecord("dev1", "2025-06-04", ReportRecord{Status: ReportStatusValid, Signature: "verified"}))
+
+	var archive bytes.Buffer
+	entries, err := db.Backup(&archive)
+	require.NoError(t, err)
+	assert.Greater(t, entries, 3)
+
+	// writes after the snapshot are not part of the archive
+	require.NoError(t, db.AddDevice("dev2", "liq2", "Plug", "plug", "plmnt2", ""))
+
+	restoreCfg := config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "restored.db")}
+	restored, err := Restore(bytes.NewReader(archive.Bytes()), restoreCfg)
+	require.NoError(t, err)
+	assert.Equal(t, entries, restored)
+
+	rdb, err := NewDatabase(restoreCfg)
+	require.NoError(t, err)
+	defer rdb.Close()
+	devices, err := rdb.GetByLiquidAddress("liq1")
+	require.NoError(t, err)
+	assert.Contains(t, devices, "dev1")
+	_, found, err := rdb.GetDevice("dev2")
+	require.NoError(t, err)
+	assert.False(t, found)
+	record, found, err := rdb.GetReportRecord("dev1", "2025-06-04")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, ReportStatusValid, record.Status)
+	assert.Equal(t, "verified", record.Signature)
+}
+
+func TestRestore_Rejects(t *testing.T) {
+	db, err := NewDatabase(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.AddDevice("dev1", "liq1", "Plug", "plug", "plmnt1", ""))
+	var archive bytes.Buffer
+	_, err = db.Backup(&archive)
+	require.NoError(t, err)
+
+	// the target directory must be empty
+	target := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(target, "LOCK"), nil, 0o600))
+	_, err = Restore(bytes.NewReader(archive.Bytes()), config.DatabaseConfig{Path: target})
+	assert.ErrorContains(t, err, "not empty")
+
+	// truncated and foreign archives are rejected
+	truncated := archive.Bytes()[:archive.Len()-4]
+	_, err = Restore(bytes.NewReader(truncated), config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "a.db")})
+	assert.Error(t, err)
+	_, err = Restore(bytes.NewReader([]byte("not an archive")), config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "b.db")})
+	assert.ErrorContains(t, err, "invalid backup archive")
+}
@@ -2,41 +2,182 @@ package database
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/rddl-network/energy-service/internal/config"
 )
 
+const mib = 1024 * 1024
+
 // Device represents a registered device
 type Device struct {
 	LiquidAddress     string    `json:"liquid_address"`
 	DeviceName        string    `json:"device_name"`
 	DeviceType        string    `json:"device_type"`
 	PlanetmintAddress string    `json:"planetmint_address"`
+	PublicKey         string    `json:"public_key,omitempty"` // hex encoded secp256k1 key used to verify reports
 	Timestamp         time.Time `json:"timestamp"`
 }
 
+// MeterReset records that the counter of a device restarted, e.g. after a firmware reset or a meter swap
+type MeterReset struct {
+	Baseline       float64   `json:"baseline"`                  // counter value of the device right after the reset in kWh
+	ImportBaseline *float64  `json:"import_baseline,omitempty"` // import register right after the reset in kWh, nil if not given
+	ExportBaseline *float64  `json:"export_baseline,omitempty"` // export register right after the reset in kWh, nil if not given
+	ResetAt        time.Time `json:"reset_at"`                  // time of the reset
+	RecordedAt     time.Time `json:"recorded_at"`               // time the reset was recorded
+}
+
+// LastReading is the last accepted cumulative value of each register of a device in kWh,
+// it is the base of the check that reports do not decrease
+type LastReading struct {
+	Timestamp time.Time `json:"timestamp"` // timestamp of the last interval of the report
+	EnergyKWh float64   `json:"energy_kwh"`
+	ImportKWh *float64  `json:"import_kwh,omitempty"` // nil if the device never reported the register
+	ExportKWh *float64  `json:"export_kwh,omitempty"`
+}
+
+// Report states
+const (
+	ReportStatusValid   = "valid"
+	ReportStatusInvalid = "invalid"
+)
+
+// Outcomes of writing a report to InfluxDB
+const (
+	InfluxWritePending = "pending"
+	InfluxWriteWritten = "written"
+	InfluxWriteFailed  = "failed"
+	InfluxWriteSkipped = "skipped"
+)
+
+// ReportRecord describes how the report of a device for a day was processed
+type ReportRecord struct {
+	Status        string    `json:"status"`                 // valid or invalid
+	Reason        string    `json:"reason,omitempty"`       // why the report is invalid
+	ReceivedAt    time.Time `json:"received_at"`            // time the report arrived
+	Source        string    `json:"source"`                 // transport the report arrived over: http or mqtt
+	PayloadSHA256 string    `json:"payload_sha256"`         // hex encoded SHA-256 of the raw payload
+	Signature     string    `json:"signature,omitempty"`    // verified or unsigned
+	InfluxWrite   string    `json:"influx_write"`           // pending, written, failed or skipped
+	InfluxError   string    `json:"influx_error,omitempty"` // error of a failed InfluxDB write
+}
+
+// Actions recorded in the device history
+const (
+	DeviceChangeUpdate = "update"
+	DeviceChangeDelete = "delete"
+)
+
+// DeviceChange is an entry of the device history, it keeps the device record as it was before the change
+type DeviceChange struct {
+	Action    string    `json:"action"`           // update or delete
+	Fields    []string  `json:"fields,omitempty"` // changed fields of an update
+	Previous  Device    `json:"previous"`         // device record before the change
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ErrDeviceNotFound is returned when changing a device that is not registered
+var ErrDeviceNotFound = errors.New("device not found")
+
 // Database is a LevelDB key-value store using Zigbee ID as the key
 type Database struct {
 	db    *leveldb.DB
+	wo    *opt.WriteOptions
 	mutex sync.RWMutex
 }
 
-// NewDatabase creates a new LevelDB database
-func NewDatabase() (*Database, error) {
-	db, err := leveldb.OpenFile("devices.db", nil)
+// DriverLevelDB selects the LevelDB Database, see NewSQLDatabase for the SQL drivers
+const DriverLevelDB = "leveldb"
+
+// Open opens the device store selected by the driver of cfg
+func Open(cfg config.DatabaseConfig) (DeviceStore, error) {
+	switch cfg.Driver {
+	case "", DriverLevelDB:
+		db, err := NewDatabase(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case DriverSQLite, DriverPostgres:
+		db, err := NewSQLDatabase(cfg.Driver, cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %s", cfg.Driver)
+}
+
+// NewDatabase opens or creates the LevelDB database described by cfg
+func NewDatabase(cfg config.DatabaseConfig) (*Database, error) {
+	return openDatabase(cfg, false)
+}
+
+// NewReadOnlyDatabase opens an existing LevelDB database without write access.
+// Several read-only instances may share a database, but LevelDB does not allow
+// opening it while a writer (e.g. a running energy-service) holds the lock.
+func NewReadOnlyDatabase(cfg config.DatabaseConfig) (*Database, error) {
+	return openDatabase(cfg, true)
+}
+
+func openDatabase(cfg config.DatabaseConfig, readOnly bool) (*Database, error) {
+	store, err := openLevelDB(cfg, readOnly)
+	if err != nil || readOnly {
+		return store, err
+	}
+	if _, err := store.migrate(false); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func openLevelDB(cfg config.DatabaseConfig, readOnly bool) (*Database, error) {
+	options := &opt.Options{
+		BlockCacheCapacity:  cfg.CacheSizeMB * mib,
+		WriteBuffer:         cfg.WriteBufferMB * mib,
+		CompactionTableSize: cfg.CompactionTableSizeMB * mib,
+		CompactionL0Trigger: cfg.CompactionL0Trigger,
+		ReadOnly:            readOnly,
+		ErrorIfMissing:      readOnly,
+	}
+	db, err := leveldb.OpenFile(cfg.Path, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
+		return nil, fmt.Errorf("failed to open database %s: %v", cfg.Path, err)
 	}
 
 	return &Database{
 		db: db,
+		wo: &opt.WriteOptions{Sync: cfg.SyncWrites},
 	}, nil
 }
 
+// Iterate calls fn for every key-value pair in key order and stops at the first error.
+// key and value are only valid during the call.
+func (db *Database) Iterate(fn func(key, value []byte) error) error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	iter := db.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := fn(iter.Key(), iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
 // Close closes the database
 func (db *Database) Close() {
 	err := db.db.Close()
@@ -45,13 +186,8 @@ func (db *Database) Close() {
 	}
 }
 
-// keyForZigbeeID returns the LevelDB key for a given Zigbee ID
-func keyForZigbeeID(zigbeeID string) []byte {
-	return []byte("device:" + zigbeeID)
-}
-
 // AddDevice adds a new device to the database
-func (db *Database) AddDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress string) error {
+func (db *Database) AddDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey string) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
@@ -60,17 +196,42 @@ func (db *Database) AddDevice(zigbeeID, liquidAddress, deviceName, deviceType, p
 		DeviceName:        deviceName,
 		DeviceType:        deviceType,
 		PlanetmintAddress: planetmintAddress,
+		PublicKey:         publicKey,
 		Timestamp:         time.Now(),
 	}
+	return db.putDevice(zigbeeID, device)
+}
+
+// PutDevice stores a device record as given, e.g. when importing devices, and keeps the indexes in sync
+func (db *Database) PutDevice(zigbeeID string, device Device) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.putDevice(zigbeeID, device)
+}
 
+func (db *Database) putDevice(zigbeeID string, device Device) error {
 	// Serialize the device to JSON
 	data, err := json.Marshal(device)
 	if err != nil {
 		return fmt.Errorf("failed to marshal device data: %v", err)
 	}
 
-	// Store in LevelDB
-	err = db.db.Put(keyForZigbeeID(zigbeeID), data, nil)
+	// Store the device and its index keys in one batch, dropping the index keys of a replaced device
+	batch := new(leveldb.Batch)
+	old, exists, err := db.getDevice(zigbeeID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		for _, key := range indexKeys(zigbeeID, old) {
+			batch.Delete(key)
+		}
+	}
+	batch.Put(keyForZigbeeID(zigbeeID), data)
+	for _, key := range indexKeys(zigbeeID, device) {
+		batch.Put(key, nil)
+	}
+	err = db.db.Write(batch, db.wo)
 	if err != nil {
 		return fmt.Errorf("failed to store device: %v", err)
 	}
@@ -82,7 +243,10 @@ func (db *Database) AddDevice(zigbeeID, liquidAddress, deviceName, deviceType, p
 func (db *Database) GetDevice(zigbeeID string) (Device, bool, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
+	return db.getDevice(zigbeeID)
+}
 
+func (db *Database) getDevice(zigbeeID string) (Device, bool, error) {
 	var device Device
 
 	// Get from LevelDB
@@ -116,10 +280,10 @@ func (db *Database) GetAllDevices() (map[string]Device, error) {
 
 	for iter.Next() {
 		key := string(iter.Key())
-		if !strings.HasPrefix(key, "device:") {
+		if !strings.HasPrefix(key, devicePrefix) {
 			continue
 		}
-		zigbeeID := strings.TrimPrefix(key, "device:")
+		zigbeeID := strings.TrimPrefix(key, devicePrefix)
 		var device Device
 
 		// Deserialize the JSON data
@@ -140,32 +304,39 @@ func (db *Database) GetAllDevices() (map[string]Device, error) {
 
 // GetByLiquidAddress returns devices with a specific liquid address
 func (db *Database) GetByLiquidAddress(liquidAddress string) (map[string]Device, error) {
+	return db.getByIndex(indexLiquidAddress, liquidAddress)
+}
+
+// GetByPlanetmintAddress returns devices with a specific planetmint address
+func (db *Database) GetByPlanetmintAddress(planetmintAddress string) (map[string]Device, error) {
+	return db.getByIndex(indexPlanetmintAddress, planetmintAddress)
+}
+
+// GetByDeviceType returns devices of a specific device type
+func (db *Database) GetByDeviceType(deviceType string) (map[string]Device, error) {
+	return db.getByIndex(indexDeviceType, deviceType)
+}
+
+func (db *Database) getByIndex(index, value string) (map[string]Device, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
 	result := make(map[string]Device)
 
-	// Iterate over all entries in LevelDB
-	iter := db.db.NewIterator(nil, nil)
+	prefix := indexPrefix(index, value)
+	iter := db.db.NewIterator(util.BytesPrefix(prefix), nil)
 	defer iter.Release()
 
 	for iter.Next() {
-		key := string(iter.Key())
-		if !strings.HasPrefix(key, "device:") {
-			continue
-		}
-		zigbeeID := strings.TrimPrefix(key, "device:")
-		var device Device
-
-		// Deserialize the JSON data
-		err := json.Unmarshal(iter.Value(), &device)
+		zigbeeID := string(iter.Key()[len(prefix):])
+		device, exists, err := db.getDevice(zigbeeID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal device data: %v", err)
+			return nil, err
 		}
-
-		if device.LiquidAddress == liquidAddress {
-			result[zigbeeID] = device
+		if !exists {
+			return nil, fmt.Errorf("index %s points to missing device %s", index, zigbeeID)
 		}
+		result[zigbeeID] = device
 	}
 
 	if err := iter.Error(); err != nil {
@@ -175,29 +346,383 @@ func (db *Database) GetByLiquidAddress(liquidAddress string) (map[string]Device,
 	return result, nil
 }
 
+// UpdateDevice changes the given properties of a device, empty values are left unchanged.
+// The previous record is kept in the device history.
+func (db *Database) UpdateDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey, changedBy string) (Device, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	old, exists, err := db.getDevice(zigbeeID)
+	if err != nil {
+		return Device{}, err
+	}
+	if !exists {
+		return Device{}, ErrDeviceNotFound
+	}
+
+	device := old
+	var fields []string
+	update := func(field string, value *string, newValue string) {
+		if newValue != "" && newValue != *value {
+			*value = newValue
+			fields = append(fields, field)
+		}
+	}
+	update("liquid_address", &device.LiquidAddress, liquidAddress)
+	update("device_name", &device.DeviceName, deviceName)
+	update("device_type", &device.DeviceType, deviceType)
+	update("planetmint_address", &device.PlanetmintAddress, planetmintAddress)
+	update("public_key", &device.PublicKey, publicKey)
+	if len(fields) == 0 {
+		return device, nil
+	}
+
+	data, err := json.Marshal(device)
+	if err != nil {
+		return Device{}, fmt.Errorf("failed to marshal device data: %v", err)
+	}
+
+	batch := new(leveldb.Batch)
+	if err := putDeviceChange(batch, zigbeeID, DeviceChange{
+		Action:    DeviceChangeUpdate,
+		Fields:    fields,
+		Previous:  old,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now().UTC(),
+	}); err != nil {
+		return Device{}, err
+	}
+	for _, key := range indexKeys(zigbeeID, old) {
+		batch.Delete(key)
+	}
+	batch.Put(keyForZigbeeID(zigbeeID), data)
+	for _, key := range indexKeys(zigbeeID, device) {
+		batch.Put(key, nil)
+	}
+	if err := db.db.Write(batch, db.wo); err != nil {
+		return Device{}, fmt.Errorf("failed to update device: %v", err)
+	}
+	return device, nil
+}
+
+// DeleteDevice deregisters a device. Its history, report states and meter resets are kept.
+func (db *Database) DeleteDevice(zigbeeID, changedBy string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	old, exists, err := db.getDevice(zigbeeID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrDeviceNotFound
+	}
+
+	batch := new(leveldb.Batch)
+	if err := putDeviceChange(batch, zigbeeID, DeviceChange{
+		Action:    DeviceChangeDelete,
+		Previous:  old,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now().UTC(),
+	}); err != nil {
+		return err
+	}
+	batch.Delete(keyForZigbeeID(zigbeeID))
+	for _, key := range indexKeys(zigbeeID, old) {
+		batch.Delete(key)
+	}
+	if err := db.db.Write(batch, db.wo); err != nil {
+		return fmt.Errorf("failed to delete device: %v", err)
+	}
+	return nil
+}
+
+// GetDeviceHistory returns the changes of a device, oldest first
+func (db *Database) GetDeviceHistory(zigbeeID string) ([]DeviceChange, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var history []DeviceChange
+	iter := db.db.NewIterator(util.BytesPrefix(historyPrefix(zigbeeID)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var change DeviceChange
+		if err := json.Unmarshal(iter.Value(), &change); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal device change: %v", err)
+		}
+		history = append(history, change)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("iterator error: %v", err)
+	}
+	return history, nil
+}
+
+func putDeviceChange(batch *leveldb.Batch, zigbeeID string, change DeviceChange) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device change: %v", err)
+	}
+	key := append(historyPrefix(zigbeeID), fmt.Sprintf("%020d", change.ChangedAt.UnixNano())...)
+	batch.Put(key, data)
+	return nil
+}
+
 // ExistsID returns true if the Zigbee ID exists in the database
 func (db *Database) ExistsID(id string) (bool, error) {
 	_, exists, err := db.GetDevice(id)
 	return exists, err
 }
 
-// SetReportStatus stores the validation status ("valid" or "invalid") for a given ID and date
-func (db *Database) SetReportStatus(id, date, status string) error {
-	key := []byte("report:device:" + id + ",date:" + date)
-	return db.db.Put(key, []byte(status), nil)
+// SetReportRecord stores how the report of a device for a date was processed
+func (db *Database) SetReportRecord(id, date string, record ReportRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report record: %v", err)
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.db.Put(keyForReport(id, date), data, db.wo)
+}
+
+// ClaimReport stores the record of a report unless a report for the ID and date exists already.
+// It returns false if the report was claimed before; check and put happen atomically.
+// The last reading of an accepted report is stored in the same write.
+func (db *Database) ClaimReport(id, date string, record ReportRecord, reading *LastReading) (bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal report record: %v", err)
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(keyForReport(id, date), data)
+	if reading != nil {
+		readingData, err := json.Marshal(reading)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal last reading: %v", err)
+		}
+		batch.Put(keyForLastReading(id), readingData)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	key := keyForReport(id, date)
+	exists, err := db.db.Has(key, nil)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+	if err := db.db.Write(batch, db.wo); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseReport undoes ClaimReport for a report that could not be stored: the record is removed
+// and the last reading is set back to previous, or removed if previous is nil
+func (db *Database) ReleaseReport(id, date string, previous *LastReading) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(keyForReport(id, date))
+	if previous != nil {
+		data, err := json.Marshal(previous)
+		if err != nil {
+			return fmt.Errorf("failed to marshal last reading: %v", err)
+		}
+		batch.Put(keyForLastReading(id), data)
+	} else {
+		batch.Delete(keyForLastReading(id))
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if err := db.db.Write(batch, db.wo); err != nil {
+		return fmt.Errorf("failed to release report: %v", err)
+	}
+	return nil
+}
+
+// GetPendingInfluxWrites returns the dates of the reports whose InfluxDB write is pending, keyed by device ID
+func (db *Database) GetPendingInfluxWrites() (map[string][]string, error) {
+	pending := make(map[string][]string)
+	iter := db.db.NewIterator(util.BytesPrefix([]byte(reportKeyPrefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		record, err := decodeReportRecord(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if record.InfluxWrite != InfluxWritePending {
+			continue
+		}
+		key := strings.TrimPrefix(string(iter.Key()), reportKeyPrefix)
+		sep := strings.LastIndex(key, "/")
+		if sep < 0 {
+			continue
+		}
+		pending[key[:sep]] = append(pending[key[:sep]], key[sep+1:])
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("iterator error: %v", err)
+	}
+	return pending, nil
+}
+
+// SetLastReading stores the last reading of a device, e.g. when rebuilding it from InfluxDB
+func (db *Database) SetLastReading(id string, reading LastReading) error {
+	data, err := json.Marshal(reading)
+	if err != nil {
+		return fmt.Errorf("failed to marshal last reading: %v", err)
+	}
+	return db.db.Put(keyForLastReading(id), data, db.wo)
+}
+
+// GetLastReading returns the last reading of a device, found is false if none was stored
+func (db *Database) GetLastReading(id string) (LastReading, bool, error) {
+	var reading LastReading
+	data, err := db.db.Get(keyForLastReading(id), nil)
+	if err == leveldb.ErrNotFound {
+		return reading, false, nil
+	}
+	if err != nil {
+		return reading, false, fmt.Errorf("failed to get last reading: %v", err)
+	}
+	if err := json.Unmarshal(data, &reading); err != nil {
+		return reading, false, fmt.Errorf("failed to unmarshal last reading: %v", err)
+	}
+	return reading, true, nil
+}
+
+// GetReportRecord retrieves the report record for a given ID and date
+func (db *Database) GetReportRecord(id, date string) (ReportRecord, bool, error) {
+	var record ReportRecord
+	val, err := db.db.Get(keyForReport(id, date), nil)
+	if err == leveldb.ErrNotFound {
+		return record, false, nil
+	}
+	if err != nil {
+		return record, false, err
+	}
+	record, err = decodeReportRecord(val)
+	if err != nil {
+		return record, false, err
+	}
+	return record, true, nil
+}
+
+func decodeReportRecord(val []byte) (ReportRecord, error) {
+	var record ReportRecord
+	// reports stored before report records existed only hold the status
+	if !json.Valid(val) {
+		record.Status = string(val)
+		return record, nil
+	}
+	if err := json.Unmarshal(val, &record); err != nil {
+		return record, fmt.Errorf("failed to unmarshal report record: %v", err)
+	}
+	return record, nil
+}
+
+// GetReportRecords returns the report records of a device from one date to another (inclusive), keyed by date.
+// Report keys sort by date, so only the requested range is scanned.
+func (db *Database) GetReportRecords(id, from, to string) (map[string]ReportRecord, error) {
+	records := make(map[string]ReportRecord)
+	prefix := reportPrefix(id)
+	rng := &util.Range{
+		Start: keyForReport(id, from),
+		Limit: append(keyForReport(id, to), 0),
+	}
+	iter := db.db.NewIterator(rng, nil)
+	defer iter.Release()
+	for iter.Next() {
+		date := strings.TrimPrefix(string(iter.Key()), prefix)
+		record, err := decodeReportRecord(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		records[date] = record
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("iterator error: %v", err)
+	}
+	return records, nil
+}
+
+// DeleteReport removes the report record of a device for a date,
+// it returns false if no report was stored. The cached last reading of the device may stem
+// from the report, so it is removed as well and rebuilt from InfluxDB with the next report.
+func (db *Database) DeleteReport(id, date string) (bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	found, err := db.db.Has(keyForReport(id, date), nil)
+	if err != nil || !found {
+		return false, err
+	}
+	batch := new(leveldb.Batch)
+	batch.Delete(keyForReport(id, date))
+	batch.Delete(keyForLastReading(id))
+	if err := db.db.Write(batch, db.wo); err != nil {
+		return false, fmt.Errorf("failed to delete report: %v", err)
+	}
+	return true, nil
+}
+
+// Compact compacts the whole key space, dropping deleted and overwritten entries from disk
+func (db *Database) Compact() error {
+	return db.db.CompactRange(util.Range{})
 }
 
-// GetReportStatus retrieves the validation status for a given ID and date
+// GetReportStatus retrieves the validation status for a given ID and date, empty if no report was stored
 func (db *Database) GetReportStatus(id, date string) (string, error) {
-	key := []byte("report:device:" + id + ",date:" + date)
-	val, err := db.db.Get(key, nil)
+	record, _, err := db.GetReportRecord(id, date)
+	return record.Status, err
+}
+
+// AddMeterReset appends a meter reset event to the reset history of a device
+func (db *Database) AddMeterReset(id string, reset MeterReset) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	resets, err := db.getMeterResets(id)
+	if err != nil {
+		return err
+	}
+	resets = append(resets, reset)
+
+	data, err := json.Marshal(resets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal meter resets: %v", err)
+	}
+	err = db.db.Put(keyForMeterResets(id), data, db.wo)
+	if err != nil {
+		return fmt.Errorf("failed to store meter reset: %v", err)
+	}
+	return nil
+}
+
+// GetMeterResets returns all meter reset events of a device in the order they were recorded
+func (db *Database) GetMeterResets(id string) ([]MeterReset, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.getMeterResets(id)
+}
+
+func (db *Database) getMeterResets(id string) ([]MeterReset, error) {
+	var resets []MeterReset
+	data, err := db.db.Get(keyForMeterResets(id), nil)
 	if err == leveldb.ErrNotFound {
-		return "", nil
+		return resets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meter resets: %v", err)
 	}
+	err = json.Unmarshal(data, &resets)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to unmarshal meter resets: %v", err)
 	}
-	return string(val), nil
+	return resets, nil
 }
 
 // DeviceStore abstracts device DB operations for mocking
@@ -207,10 +732,24 @@ func (db *Database) GetReportStatus(id, date string) (string, error) {
 //go:generate mockery --name=DeviceStore
 type DeviceStore interface {
 	GetDevice(id string) (Device, bool, error)
-	AddDevice(id, liquidAddress, deviceName, deviceType, planetmintAddress string) error
+	AddDevice(id, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey string) error
 	ExistsID(id string) (bool, error)
 	GetAllDevices() (map[string]Device, error)
 	GetByLiquidAddress(liquidAddress string) (map[string]Device, error)
-	SetReportStatus(id, date, status string) error
+	GetByPlanetmintAddress(planetmintAddress string) (map[string]Device, error)
+	GetByDeviceType(deviceType string) (map[string]Device, error)
+	UpdateDevice(id, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey, changedBy string) (Device, error)
+	DeleteDevice(id, changedBy string) error
+	GetDeviceHistory(id string) ([]DeviceChange, error)
+	SetReportRecord(id, date string, record ReportRecord) error
+	ClaimReport(id, date string, record ReportRecord, reading *LastReading) (bool, error)
+	ReleaseReport(id, date string, previous *LastReading) error
+	GetPendingInfluxWrites() (map[string][]string, error)
+	GetReportRecord(id, date string) (ReportRecord, bool, error)
+	GetReportRecords(id, from, to string) (map[string]ReportRecord, error)
 	GetReportStatus(id, date string) (string, error)
+	AddMeterReset(id string, reset MeterReset) error
+	GetMeterResets(id string) ([]MeterReset, error)
+	SetLastReading(id string, reading LastReading) error
+	GetLastReading(id string) (LastReading, bool, error)
 }
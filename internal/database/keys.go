@@ -0,0 +1,69 @@
+package database
+
+// LevelDB key schema, see migrations.go for how older layouts are rewritten. All keys start with
+// a prefix naming the kind of entry, the parts of a key are separated by slashes.
+//
+//	device/<id>                                    device record
+//	idx/<index>/<value>\x00<id>                    secondary index entry, empty value
+//	history/<id>/<unix nano>                       previous version of a device record
+//	report/<id>/<date>                             report record, sorted by date
+//	reset/<id>                                     meter reset events
+//	reading/<id>                                   last accepted reading of the registers
+//	meta/schema_version                            version of this layout
+const (
+	devicePrefix     = "device/"
+	indexKeyPrefix   = "idx/"
+	historyKeyPrefix = "history/"
+	reportKeyPrefix  = "report/"
+	resetKeyPrefix   = "reset/"
+	readingKeyPrefix = "reading/"
+	schemaVersionKey = "meta/schema_version"
+)
+
+// Secondary indexes map a device property to the Zigbee IDs of the devices having it
+const (
+	indexLiquidAddress     = "liquid_address"
+	indexPlanetmintAddress = "planetmint_address"
+	indexDeviceType        = "device_type"
+)
+
+// keyForZigbeeID returns the LevelDB key for a given Zigbee ID
+func keyForZigbeeID(zigbeeID string) []byte {
+	return []byte(devicePrefix + zigbeeID)
+}
+
+func indexPrefix(index, value string) []byte {
+	return []byte(indexKeyPrefix + index + "/" + value + "\x00")
+}
+
+// indexKeys returns the index keys of a device
+func indexKeys(zigbeeID string, device Device) [][]byte {
+	return [][]byte{
+		append(indexPrefix(indexLiquidAddress, device.LiquidAddress), zigbeeID...),
+		append(indexPrefix(indexPlanetmintAddress, device.PlanetmintAddress), zigbeeID...),
+		append(indexPrefix(indexDeviceType, device.DeviceType), zigbeeID...),
+	}
+}
+
+// historyPrefix returns the key prefix of the history entries of a device,
+// the entries are ordered by the time of the change
+func historyPrefix(zigbeeID string) []byte {
+	return []byte(historyKeyPrefix + zigbeeID + "/")
+}
+
+// reportPrefix returns the key prefix of the reports of a device, the reports are ordered by date
+func reportPrefix(id string) string {
+	return reportKeyPrefix + id + "/"
+}
+
+func keyForReport(id, date string) []byte {
+	return []byte(reportPrefix(id) + date)
+}
+
+func keyForMeterResets(id string) []byte {
+	return []byte(resetKeyPrefix + id)
+}
+
+func keyForLastReading(id string) []byte {
+	return []byte(readingKeyPrefix + id)
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/rddl-network/energy-service/internal/config"
+)
+
+// keyMigration rewrites the keys of a store, migration i brings a store from version i to i+1.
+// Migrations are applied in order and must never change once released.
+type keyMigration struct {
+	description string
+	apply       func(tr *leveldb.Transaction) (*leveldb.Batch, error)
+}
+
+var keyMigrations = []keyMigration{
+	{"move device and report keys to the slash separated layout", migrateSlashKeys},
+	{"build secondary device indexes", migrateBuildIndexes},
+}
+
+// MigrationResult describes a schema migration that was applied, or would be applied in a dry run
+type MigrationResult struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Keys        int    `json:"keys"` // number of written and deleted keys
+}
+
+// DryRunMigrations reports the pending schema migrations of the LevelDB store described by cfg
+// without changing it
+func DryRunMigrations(cfg config.DatabaseConfig) ([]MigrationResult, error) {
+	db, err := openLevelDB(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.migrate(true)
+}
+
+// ErrNeedsMigration is returned for a store whose schema is older than the current one
+var ErrNeedsMigration = errors.New("store needs migration")
+
+// CheckSchema checks that the store has the current schema. Stores opened read-only are not
+// migrated, so reading an older store would silently find nothing under the current keys.
+func (db *Database) CheckSchema() error {
+	version, err := schemaVersion(db.db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if version < len(keyMigrations) {
+		return fmt.Errorf("%w: schema version %d, current version %d", ErrNeedsMigration, version, len(keyMigrations))
+	}
+	if version > len(keyMigrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(keyMigrations))
+	}
+	return nil
+}
+
+func schemaVersion(reader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+}) (int, error) {
+	val, err := reader.Get([]byte(schemaVersionKey), nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(val))
+}
+
+// migrate applies the pending migrations in a single transaction, which is discarded in a dry run
+func (db *Database) migrate(dryRun bool) ([]MigrationResult, error) {
+	tr, err := db.db.OpenTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transaction: %v", err)
+	}
+	defer tr.Discard()
+
+	version, err := schemaVersion(tr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if version > len(keyMigrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than supported version %d", version, len(keyMigrations))
+	}
+
+	var results []MigrationResult
+	for v := version + 1; v <= len(keyMigrations); v++ {
+		migration := keyMigrations[v-1]
+		batch, err := migration.apply(tr)
+		if err != nil {
+			return nil, fmt.Errorf("schema migration %d failed: %v", v, err)
+		}
+		batch.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(v)))
+		// later migrations see the changes of earlier ones, also in a dry run
+		if err := tr.Write(batch, nil); err != nil {
+			return nil, fmt.Errorf("schema migration %d failed: %v", v, err)
+		}
+		results = append(results, MigrationResult{Version: v, Description: migration.description, Keys: batch.Len() - 1})
+	}
+
+	if dryRun || len(results) == 0 {
+		return results, nil
+	}
+	if err := tr.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit schema migrations: %v", err)
+	}
+	for _, result := range results {
+		log.Printf("Applied database schema migration %d: %s (%d keys)", result.Version, result.Description, result.Keys)
+	}
+	return results, nil
+}
+
+// migrateSlashKeys moves "device:<id>" to "device/<id>" and "report:device:<id>,date:<date>" to
+// "report/<id>/<date>", so that all keys use the same separator and a device's reports sort by date
+func migrateSlashKeys(tr *leveldb.Transaction) (*leveldb.Batch, error) {
+	const (
+		oldDevicePrefix = "device:"
+		oldReportPrefix = "report:device:"
+	)
+	batch := new(leveldb.Batch)
+	move := func(prefix string, newKey func(rest string) ([]byte, bool)) error {
+		iter := tr.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+		defer iter.Release()
+		for iter.Next() {
+			key, ok := newKey(strings.TrimPrefix(string(iter.Key()), prefix))
+			if !ok {
+				return fmt.Errorf("unexpected key %q", iter.Key())
+			}
+			batch.Put(key, append([]byte(nil), iter.Value()...))
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+		if err := iter.Error(); err != nil {
+			return fmt.Errorf("iterator error: %v", err)
+		}
+		return nil
+	}
+	if err := move(oldDevicePrefix, func(id string) ([]byte, bool) {
+		return keyForZigbeeID(id), id != ""
+	}); err != nil {
+		return nil, err
+	}
+	if err := move(oldReportPrefix, func(rest string) ([]byte, bool) {
+		id, date, found := strings.Cut(rest, ",date:")
+		return keyForReport(id, date), found
+	}); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// migrateBuildIndexes indexes the devices of a store created before secondary indexes existed
+func migrateBuildIndexes(tr *leveldb.Transaction) (*leveldb.Batch, error) {
+	batch := new(leveldb.Batch)
+	iter := tr.NewIterator(util.BytesPrefix([]byte(devicePrefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var device Device
+		if err := json.Unmarshal(iter.Value(), &device); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal device data: %v", err)
+		}
+		for _, key := range indexKeys(strings.TrimPrefix(string(iter.Key()), devicePrefix), device) {
+			batch.Put(key, nil)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("iterator error: %v", err)
+	}
+	return batch, nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+
+	"github.com/rddl-network/energy-service/internal/config"
+)
+
+// newLegacyStore creates a store in the layout before schema versions existed
+func newLegacyStore(t *testing.T) config.DatabaseConfig {
+	cfg := config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")}
+	db, err := leveldb.OpenFile(cfg.Path, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Put([]byte("device:dev1"), []byte(`{"liquid_address":"liq1","device_type":"plug","planetmint_address":"plmnt1"}`), nil))
+	require.NoError(t, db.Put([]byte("report:device:dev1,date:2025-06-04"), []byte("valid"), nil))
+	require.NoError(t, db.Put([]byte("report:device:dev1,date:2025-06-05"), []byte(`{"status":"invalid"}`), nil))
+	require.NoError(t, db.Close())
+	return cfg
+}
+
+func TestMigrations(t *testing.T) {
+	cfg := newLegacyStore(t)
+
+	db, err := NewDatabase(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+
+	version, err := db.db.Get([]byte(schemaVersionKey), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(version))
+
+	records, err := db.GetReportRecords("dev1", "2025-06-01", "2025-06-30")
+	require.NoError(t, err)
+	assert.Equal(t, ReportStatusValid, records["2025-06-04"].Status)
+	assert.Equal(t, ReportStatusInvalid, records["2025-06-05"].Status)
+	devices, err := db.GetByLiquidAddress("liq1")
+	require.NoError(t, err)
+	assert.Contains(t, devices, "dev1")
+
+	for _, key := range []string{"device:dev1", "report:device:dev1,date:2025-06-04"} {
+		legacy, err := db.db.Has([]byte(key), nil)
+		require.NoError(t, err)
+		assert.False(t, legacy, key)
+	}
+}
+
+func TestMigrations_DryRun(t *testing.T) {
+	cfg := newLegacyStore(t)
+
+	results, err := DryRunMigrations(cfg)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, 6, results[0].Keys) // device and two reports moved
+	assert.Equal(t, 3, results[1].Keys) // three index keys of dev1
+
+	// the store is unchanged
+	db, err := leveldb.OpenFile(cfg.Path, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Get([]byte(schemaVersionKey), nil)
+	assert.Equal(t, leveldb.ErrNotFound, err)
+	legacy, err := db.Has([]byte("report:device:dev1,date:2025-06-04"), nil)
+	require.NoError(t, err)
+	assert.True(t, legacy)
+}
+
+func TestMigrations_NewerSchema(t *testing.T) {
+	cfg := config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")}
+	db, err := leveldb.OpenFile(cfg.Path, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Put([]byte(schemaVersionKey), []byte("99"), nil))
+	require.NoError(t, db.Close())
+
+	_, err = NewDatabase(cfg)
+	assert.ErrorContains(t, err, "newer than supported")
+}
+
+func TestCheckSchema(t *testing.T) {
+	cfg := newLegacyStore(t)
+
+	db, err := NewReadOnlyDatabase(cfg)
+	require.NoError(t, err)
+	assert.ErrorIs(t, db.CheckSchema(), ErrNeedsMigration)
+	db.Close()
+
+	db, err = NewDatabase(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, db.CheckSchema())
+}
@@ -13,8 +13,8 @@ func (m *MockDatabase) GetDevice(zigbeeID string) (Device, bool, error) {
 	return args.Get(0).(Device), args.Bool(1), args.Error(2)
 }
 
-func (m *MockDatabase) AddDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress string) error {
-	args := m.Called(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress)
+func (m *MockDatabase) AddDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey string) error {
+	args := m.Called(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey)
 	return args.Error(0)
 }
 
@@ -33,12 +33,82 @@ func (m *MockDatabase) GetByLiquidAddress(liquidAddress string) (map[string]Devi
 	return args.Get(0).(map[string]Device), args.Error(1)
 }
 
-func (m *MockDatabase) SetReportStatus(zigbeeID, date, status string) error {
-	args := m.Called(zigbeeID, date, status)
+func (m *MockDatabase) GetByPlanetmintAddress(planetmintAddress string) (map[string]Device, error) {
+	args := m.Called(planetmintAddress)
+	return args.Get(0).(map[string]Device), args.Error(1)
+}
+
+func (m *MockDatabase) GetByDeviceType(deviceType string) (map[string]Device, error) {
+	args := m.Called(deviceType)
+	return args.Get(0).(map[string]Device), args.Error(1)
+}
+
+func (m *MockDatabase) UpdateDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey, changedBy string) (Device, error) {
+	args := m.Called(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey, changedBy)
+	return args.Get(0).(Device), args.Error(1)
+}
+
+func (m *MockDatabase) DeleteDevice(zigbeeID, changedBy string) error {
+	args := m.Called(zigbeeID, changedBy)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetDeviceHistory(zigbeeID string) ([]DeviceChange, error) {
+	args := m.Called(zigbeeID)
+	return args.Get(0).([]DeviceChange), args.Error(1)
+}
+
+func (m *MockDatabase) SetReportRecord(zigbeeID, date string, record ReportRecord) error {
+	args := m.Called(zigbeeID, date, record)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) ClaimReport(zigbeeID, date string, record ReportRecord, reading *LastReading) (bool, error) {
+	args := m.Called(zigbeeID, date, record, reading)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDatabase) ReleaseReport(zigbeeID, date string, previous *LastReading) error {
+	args := m.Called(zigbeeID, date, previous)
 	return args.Error(0)
 }
 
+func (m *MockDatabase) GetPendingInfluxWrites() (map[string][]string, error) {
+	args := m.Called()
+	return args.Get(0).(map[string][]string), args.Error(1)
+}
+
+func (m *MockDatabase) GetReportRecord(zigbeeID, date string) (ReportRecord, bool, error) {
+	args := m.Called(zigbeeID, date)
+	return args.Get(0).(ReportRecord), args.Bool(1), args.Error(2)
+}
+
+func (m *MockDatabase) GetReportRecords(zigbeeID, from, to string) (map[string]ReportRecord, error) {
+	args := m.Called(zigbeeID, from, to)
+	return args.Get(0).(map[string]ReportRecord), args.Error(1)
+}
+
 func (m *MockDatabase) GetReportStatus(zigbeeID, date string) (string, error) {
 	args := m.Called(zigbeeID, date)
 	return args.String(0), args.Error(1)
 }
+
+func (m *MockDatabase) AddMeterReset(zigbeeID string, reset MeterReset) error {
+	args := m.Called(zigbeeID, reset)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetMeterResets(zigbeeID string) ([]MeterReset, error) {
+	args := m.Called(zigbeeID)
+	return args.Get(0).([]MeterReset), args.Error(1)
+}
+
+func (m *MockDatabase) SetLastReading(zigbeeID string, reading LastReading) error {
+	args := m.Called(zigbeeID, reading)
+	return args.Error(0)
+}
+
+func (m *MockDatabase) GetLastReading(zigbeeID string) (LastReading, bool, error) {
+	args := m.Called(zigbeeID)
+	return args.Get(0).(LastReading), args.Bool(1), args.Error(2)
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rddl-network/energy-service/internal/config"
+)
+
+func TestLastReading(t *testing.T) {
+	levelDB, err := NewDatabase(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")})
+	require.NoError(t, err)
+	t.Cleanup(levelDB.Close)
+	stores := map[string]DeviceStore{
+		DriverLevelDB: levelDB,
+		DriverSQLite:  newTestSQLDatabase(t),
+	}
+
+	for name, db := range stores {
+		t.Run(name, func(t *testing.T) {
+			_, found, err := db.GetLastReading("dev1")
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			// the reading is stored with the claim of an accepted report
+			exportKWh := 2.5
+			reading := LastReading{Timestamp: time.Date(2025, 6, 4, 22, 0, 0, 0, time.UTC), EnergyKWh: 12.5, ExportKWh: &exportKWh}
+			claimed, err := db.ClaimReport("dev1", "2025-06-04", ReportRecord{Status: ReportStatusValid}, &reading)
+			require.NoError(t, err)
+			assert.True(t, claimed)
+			stored, found, err := db.GetLastReading("dev1")
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, reading, stored)
+
+			// a report claimed before does not move the reading
+			claimed, err = db.ClaimReport("dev1", "2025-06-04", ReportRecord{Status: ReportStatusValid}, &LastReading{EnergyKWh: 99})
+			require.NoError(t, err)
+			assert.False(t, claimed)
+			stored, _, err = db.GetLastReading("dev1")
+			require.NoError(t, err)
+			assert.Equal(t, 12.5, stored.EnergyKWh)
+
+			// neither does a rejected report
+			claimed, err = db.ClaimReport("dev1", "2025-06-05", ReportRecord{Status: ReportStatusInvalid}, nil)
+			require.NoError(t, err)
+			assert.True(t, claimed)
+			stored, _, err = db.GetLastReading("dev1")
+			require.NoError(t, err)
+			assert.Equal(t, reading, stored)
+
+			rebuilt := LastReading{Timestamp: reading.Timestamp.Add(time.Hour), EnergyKWh: 13}
+			require.NoError(t, db.SetLastReading("dev1", rebuilt))
+			stored, _, err = db.GetLastReading("dev1")
+			require.NoError(t, err)
+			assert.Equal(t, rebuilt, stored)
+		})
+	}
+}
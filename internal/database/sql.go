@@ -0,0 +1,649 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"  // PostgreSQL driver "postgres"
+	_ "modernc.org/sqlite" // pure Go SQLite driver "sqlite"
+)
+
+// SQL drivers supported by SQLDatabase
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// sqlTimeLayout stores times as sortable UTC text, portable across SQLite and PostgreSQL
+const sqlTimeLayout = "2006-01-02 15:04:05.000000000"
+
+// sqlMigrations create and evolve the schema, a migration is applied once in order and never changed
+var sqlMigrations = []string{
+	`CREATE TABLE devices (
+		id                 TEXT PRIMARY KEY,
+		liquid_address     TEXT NOT NULL,
+		device_name        TEXT NOT NULL,
+		device_type        TEXT NOT NULL,
+		planetmint_address TEXT NOT NULL,
+		public_key         TEXT NOT NULL DEFAULT '',
+		registered_at      TEXT NOT NULL
+	);
+	CREATE INDEX devices_liquid_address ON devices (liquid_address);
+	CREATE INDEX devices_planetmint_address ON devices (planetmint_address);
+	CREATE INDEX devices_device_type ON devices (device_type);
+	CREATE TABLE device_history (
+		device_id  TEXT NOT NULL,
+		changed_at TEXT NOT NULL,
+		action     TEXT NOT NULL,
+		fields     TEXT NOT NULL DEFAULT '',
+		previous   TEXT NOT NULL,
+		changed_by TEXT NOT NULL,
+		PRIMARY KEY (device_id, changed_at)
+	);
+	CREATE TABLE reports (
+		device_id      TEXT NOT NULL,
+		date           TEXT NOT NULL,
+		status         TEXT NOT NULL,
+		reason         TEXT NOT NULL DEFAULT '',
+		received_at    TEXT NOT NULL,
+		source         TEXT NOT NULL,
+		payload_sha256 TEXT NOT NULL,
+		signature      TEXT NOT NULL DEFAULT '',
+		influx_write   TEXT NOT NULL,
+		influx_error   TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (device_id, date)
+	);
+	CREATE TABLE meter_resets (
+		device_id       TEXT NOT NULL,
+		baseline        DOUBLE PRECISION NOT NULL,
+		import_baseline DOUBLE PRECISION,
+		export_baseline DOUBLE PRECISION,
+		reset_at        TEXT NOT NULL,
+		recorded_at     TEXT NOT NULL
+	);
+	CREATE INDEX meter_resets_device_id ON meter_resets (device_id, recorded_at);`,
+	`CREATE TABLE last_readings (
+		device_id  TEXT PRIMARY KEY,
+		timestamp  TEXT NOT NULL,
+		energy_kwh DOUBLE PRECISION NOT NULL,
+		import_kwh DOUBLE PRECISION,
+		export_kwh DOUBLE PRECISION
+	);`,
+}
+
+// SQLDatabase is a DeviceStore backed by SQLite or PostgreSQL
+type SQLDatabase struct {
+	db     *sql.DB
+	driver string
+	mutex  sync.Mutex // serializes read-modify-write operations
+}
+
+// NewSQLDatabase connects to the database and applies missing schema migrations.
+// driver is DriverSQLite (dsn is the file name) or DriverPostgres (dsn is a connection string).
+func NewSQLDatabase(driver, dsn string) (*SQLDatabase, error) {
+	if driver != DriverSQLite && driver != DriverPostgres {
+		return nil, fmt.Errorf("unsupported SQL driver %s", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	if driver == DriverSQLite {
+		// SQLite allows one writer; a single connection also keeps :memory: databases alive
+		db.SetMaxOpenConns(1)
+	}
+	store := &SQLDatabase{db: db, driver: driver}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close closes the database
+func (s *SQLDatabase) Close() {
+	if err := s.db.Close(); err != nil {
+		fmt.Printf("Error during database close: %v\n", err)
+	}
+}
+
+// SchemaVersion returns the number of applied schema migrations
+func (s *SQLDatabase) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+func (s *SQLDatabase) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	if version > len(sqlMigrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(sqlMigrations))
+	}
+
+	for v := version + 1; v <= len(sqlMigrations); v++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range strings.Split(sqlMigrations[v-1], ";") {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to apply schema migration %d: %v", v, err)
+			}
+		}
+		if _, err := tx.Exec(s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), v, formatSQLTime(time.Now())); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record schema migration %d: %v", v, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to apply schema migration %d: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// rebind replaces the ? placeholders of query by $1, $2, ... for PostgreSQL
+func (s *SQLDatabase) rebind(query string) string {
+	if s.driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQLDatabase) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+func formatSQLTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeLayout)
+}
+
+func parseSQLTime(value string) (time.Time, error) {
+	return time.ParseInLocation(sqlTimeLayout, value, time.UTC)
+}
+
+const deviceColumns = `id, liquid_address, device_name, device_type, planetmint_address, public_key, registered_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDevice(row rowScanner) (string, Device, error) {
+	var id, registeredAt string
+	var device Device
+	err := row.Scan(&id, &device.LiquidAddress, &device.DeviceName, &device.DeviceType, &device.PlanetmintAddress, &device.PublicKey, &registeredAt)
+	if err != nil {
+		return "", device, err
+	}
+	device.Timestamp, err = parseSQLTime(registeredAt)
+	if err != nil {
+		return "", device, fmt.Errorf("failed to parse registration time: %v", err)
+	}
+	return id, device, nil
+}
+
+// AddDevice adds a new device to the database, replacing a device with the same ID
+func (s *SQLDatabase) AddDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey string) error {
+	_, err := s.exec(`INSERT INTO devices (`+deviceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET liquid_address = excluded.liquid_address, device_name = excluded.device_name,
+		device_type = excluded.device_type, planetmint_address = excluded.planetmint_address,
+		public_key = excluded.public_key, registered_at = excluded.registered_at`,
+		zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey, formatSQLTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to store device: %v", err)
+	}
+	return nil
+}
+
+// GetDevice retrieves a device by Zigbee ID
+func (s *SQLDatabase) GetDevice(zigbeeID string) (Device, bool, error) {
+	row := s.db.QueryRow(s.rebind(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`), zigbeeID)
+	_, device, err := scanDevice(row)
+	if err == sql.ErrNoRows {
+		return Device{}, false, nil
+	}
+	if err != nil {
+		return Device{}, false, fmt.Errorf("failed to get device: %v", err)
+	}
+	return device, true, nil
+}
+
+// ExistsID returns true if the Zigbee ID exists in the database
+func (s *SQLDatabase) ExistsID(id string) (bool, error) {
+	_, exists, err := s.GetDevice(id)
+	return exists, err
+}
+
+func (s *SQLDatabase) queryDevices(where string, args ...interface{}) (map[string]Device, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT `+deviceColumns+` FROM devices `+where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %v", err)
+	}
+	defer rows.Close()
+
+	devices := make(map[string]Device)
+	for rows.Next() {
+		id, device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device: %v", err)
+		}
+		devices[id] = device
+	}
+	return devices, rows.Err()
+}
+
+// GetAllDevices returns all devices in the database
+func (s *SQLDatabase) GetAllDevices() (map[string]Device, error) {
+	return s.queryDevices("")
+}
+
+// GetByLiquidAddress returns devices with a specific liquid address
+func (s *SQLDatabase) GetByLiquidAddress(liquidAddress string) (map[string]Device, error) {
+	return s.queryDevices("WHERE liquid_address = ?", liquidAddress)
+}
+
+// GetByPlanetmintAddress returns devices with a specific planetmint address
+func (s *SQLDatabase) GetByPlanetmintAddress(planetmintAddress string) (map[string]Device, error) {
+	return s.queryDevices("WHERE planetmint_address = ?", planetmintAddress)
+}
+
+// GetByDeviceType returns devices of a specific device type
+func (s *SQLDatabase) GetByDeviceType(deviceType string) (map[string]Device, error) {
+	return s.queryDevices("WHERE device_type = ?", deviceType)
+}
+
+// UpdateDevice changes the given properties of a device, empty values are left unchanged.
+// The previous record is kept in the device history.
+func (s *SQLDatabase) UpdateDevice(zigbeeID, liquidAddress, deviceName, deviceType, planetmintAddress, publicKey, changedBy string) (Device, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists, err := s.GetDevice(zigbeeID)
+	if err != nil {
+		return Device{}, err
+	}
+	if !exists {
+		return Device{}, ErrDeviceNotFound
+	}
+
+	device := old
+	var fields []string
+	update := func(field string, value *string, newValue string) {
+		if newValue != "" && newValue != *value {
+			*value = newValue
+			fields = append(fields, field)
+		}
+	}
+	update("liquid_address", &device.LiquidAddress, liquidAddress)
+	update("device_name", &device.DeviceName, deviceName)
+	update("device_type", &device.DeviceType, deviceType)
+	update("planetmint_address", &device.PlanetmintAddress, planetmintAddress)
+	update("public_key", &device.PublicKey, publicKey)
+	if len(fields) == 0 {
+		return device, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Device{}, err
+	}
+	defer tx.Rollback()
+	err = s.insertDeviceChange(tx, zigbeeID, DeviceChange{
+		Action:    DeviceChangeUpdate,
+		Fields:    fields,
+		Previous:  old,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return Device{}, err
+	}
+	_, err = tx.Exec(s.rebind(`UPDATE devices SET liquid_address = ?, device_name = ?, device_type = ?, planetmint_address = ?, public_key = ? WHERE id = ?`),
+		device.LiquidAddress, device.DeviceName, device.DeviceType, device.PlanetmintAddress, device.PublicKey, zigbeeID)
+	if err != nil {
+		return Device{}, fmt.Errorf("failed to update device: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Device{}, fmt.Errorf("failed to update device: %v", err)
+	}
+	return device, nil
+}
+
+// DeleteDevice deregisters a device. Its history, report states and meter resets are kept.
+func (s *SQLDatabase) DeleteDevice(zigbeeID, changedBy string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, exists, err := s.GetDevice(zigbeeID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrDeviceNotFound
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = s.insertDeviceChange(tx, zigbeeID, DeviceChange{
+		Action:    DeviceChangeDelete,
+		Previous:  old,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(`DELETE FROM devices WHERE id = ?`), zigbeeID); err != nil {
+		return fmt.Errorf("failed to delete device: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete device: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLDatabase) insertDeviceChange(tx *sql.Tx, zigbeeID string, change DeviceChange) error {
+	previous, err := json.Marshal(change.Previous)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device change: %v", err)
+	}
+	_, err = tx.Exec(s.rebind(`INSERT INTO device_history (device_id, changed_at, action, fields, previous, changed_by) VALUES (?, ?, ?, ?, ?, ?)`),
+		zigbeeID, formatSQLTime(change.ChangedAt), change.Action, strings.Join(change.Fields, ","), string(previous), change.ChangedBy)
+	if err != nil {
+		return fmt.Errorf("failed to store device change: %v", err)
+	}
+	return nil
+}
+
+// GetDeviceHistory returns the changes of a device, oldest first
+func (s *SQLDatabase) GetDeviceHistory(zigbeeID string) ([]DeviceChange, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT changed_at, action, fields, previous, changed_by FROM device_history WHERE device_id = ? ORDER BY changed_at`), zigbeeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device history: %v", err)
+	}
+	defer rows.Close()
+
+	var history []DeviceChange
+	for rows.Next() {
+		var change DeviceChange
+		var changedAt, fields, previous string
+		if err := rows.Scan(&changedAt, &change.Action, &fields, &previous, &change.ChangedBy); err != nil {
+			return nil, fmt.Errorf("failed to read device change: %v", err)
+		}
+		if change.ChangedAt, err = parseSQLTime(changedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse change time: %v", err)
+		}
+		if fields != "" {
+			change.Fields = strings.Split(fields, ",")
+		}
+		if err := json.Unmarshal([]byte(previous), &change.Previous); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal device change: %v", err)
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+const reportColumns = `status, reason, received_at, source, payload_sha256, signature, influx_write, influx_error`
+
+func reportArgs(record ReportRecord) []interface{} {
+	return []interface{}{record.Status, record.Reason, formatSQLTime(record.ReceivedAt), record.Source,
+		record.PayloadSHA256, record.Signature, record.InfluxWrite, record.InfluxError}
+}
+
+func scanReport(row rowScanner, extra ...interface{}) (ReportRecord, error) {
+	var record ReportRecord
+	var receivedAt string
+	dest := append(extra, &record.Status, &record.Reason, &receivedAt, &record.Source,
+		&record.PayloadSHA256, &record.Signature, &record.InfluxWrite, &record.InfluxError)
+	if err := row.Scan(dest...); err != nil {
+		return record, err
+	}
+	var err error
+	record.ReceivedAt, err = parseSQLTime(receivedAt)
+	if err != nil {
+		return record, fmt.Errorf("failed to parse receive time: %v", err)
+	}
+	return record, nil
+}
+
+// SetReportRecord stores how the report of a device for a date was processed
+func (s *SQLDatabase) SetReportRecord(id, date string, record ReportRecord) error {
+	args := append([]interface{}{id, date}, reportArgs(record)...)
+	_, err := s.exec(`INSERT INTO reports (device_id, date, `+reportColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (device_id, date) DO UPDATE SET status = excluded.status, reason = excluded.reason,
+		received_at = excluded.received_at, source = excluded.source, payload_sha256 = excluded.payload_sha256,
+		signature = excluded.signature, influx_write = excluded.influx_write, influx_error = excluded.influx_error`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to store report record: %v", err)
+	}
+	return nil
+}
+
+// ClaimReport stores the record of a report unless a report for the ID and date exists already.
+// It returns false if the report was claimed before; check and insert happen atomically.
+func (s *SQLDatabase) ClaimReport(id, date string, record ReportRecord, reading *LastReading) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	args := append([]interface{}{id, date}, reportArgs(record)...)
+	result, err := tx.Exec(s.rebind(`INSERT INTO reports (device_id, date, `+reportColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (device_id, date) DO NOTHING`), args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim report: %v", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted != 1 {
+		return false, err
+	}
+	if reading != nil {
+		if err := s.upsertLastReading(tx, id, *reading); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to claim report: %v", err)
+	}
+	return true, nil
+}
+
+// ReleaseReport undoes ClaimReport for a report that could not be stored: the record is removed
+// and the last reading is set back to previous, or removed if previous is nil
+func (s *SQLDatabase) ReleaseReport(id, date string, previous *LastReading) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(s.rebind(`DELETE FROM reports WHERE device_id = ? AND date = ?`), id, date); err != nil {
+		return fmt.Errorf("failed to release report: %v", err)
+	}
+	if previous != nil {
+		err = s.upsertLastReading(tx, id, *previous)
+	} else {
+		_, err = tx.Exec(s.rebind(`DELETE FROM last_readings WHERE device_id = ?`), id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release report: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to release report: %v", err)
+	}
+	return nil
+}
+
+// GetPendingInfluxWrites returns the dates of the reports whose InfluxDB write is pending, keyed by device ID
+func (s *SQLDatabase) GetPendingInfluxWrites() (map[string][]string, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT device_id, date FROM reports WHERE influx_write = ? ORDER BY device_id, date`), InfluxWritePending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending reports: %v", err)
+	}
+	defer rows.Close()
+
+	pending := make(map[string][]string)
+	for rows.Next() {
+		var id, date string
+		if err := rows.Scan(&id, &date); err != nil {
+			return nil, fmt.Errorf("failed to read pending report: %v", err)
+		}
+		pending[id] = append(pending[id], date)
+	}
+	return pending, rows.Err()
+}
+
+// SetLastReading stores the last reading of a device, e.g. when rebuilding it from InfluxDB
+func (s *SQLDatabase) SetLastReading(id string, reading LastReading) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.upsertLastReading(tx, id, reading); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLDatabase) upsertLastReading(tx *sql.Tx, id string, reading LastReading) error {
+	_, err := tx.Exec(s.rebind(`INSERT INTO last_readings (device_id, timestamp, energy_kwh, import_kwh, export_kwh) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (device_id) DO UPDATE SET timestamp = excluded.timestamp, energy_kwh = excluded.energy_kwh,
+		import_kwh = excluded.import_kwh, export_kwh = excluded.export_kwh`),
+		id, formatSQLTime(reading.Timestamp), reading.EnergyKWh, reading.ImportKWh, reading.ExportKWh)
+	if err != nil {
+		return fmt.Errorf("failed to store last reading: %v", err)
+	}
+	return nil
+}
+
+// GetLastReading returns the last reading of a device, found is false if none was stored
+func (s *SQLDatabase) GetLastReading(id string) (LastReading, bool, error) {
+	var reading LastReading
+	var timestamp string
+	var importKWh, exportKWh sql.NullFloat64
+	err := s.db.QueryRow(s.rebind(`SELECT timestamp, energy_kwh, import_kwh, export_kwh FROM last_readings WHERE device_id = ?`), id).
+		Scan(&timestamp, &reading.EnergyKWh, &importKWh, &exportKWh)
+	if err == sql.ErrNoRows {
+		return reading, false, nil
+	}
+	if err != nil {
+		return reading, false, fmt.Errorf("failed to get last reading: %v", err)
+	}
+	if reading.Timestamp, err = parseSQLTime(timestamp); err != nil {
+		return reading, false, err
+	}
+	if importKWh.Valid {
+		reading.ImportKWh = &importKWh.Float64
+	}
+	if exportKWh.Valid {
+		reading.ExportKWh = &exportKWh.Float64
+	}
+	return reading, true, nil
+}
+
+// GetReportRecord retrieves the report record for a given ID and date
+func (s *SQLDatabase) GetReportRecord(id, date string) (ReportRecord, bool, error) {
+	row := s.db.QueryRow(s.rebind(`SELECT `+reportColumns+` FROM reports WHERE device_id = ? AND date = ?`), id, date)
+	record, err := scanReport(row)
+	if err == sql.ErrNoRows {
+		return ReportRecord{}, false, nil
+	}
+	if err != nil {
+		return ReportRecord{}, false, fmt.Errorf("failed to get report record: %v", err)
+	}
+	return record, true, nil
+}
+
+// GetReportRecords returns the report records of a device from one date to another (inclusive), keyed by date
+func (s *SQLDatabase) GetReportRecords(id, from, to string) (map[string]ReportRecord, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT date, `+reportColumns+` FROM reports WHERE device_id = ? AND date >= ? AND date <= ?`), id, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query report records: %v", err)
+	}
+	defer rows.Close()
+
+	records := make(map[string]ReportRecord)
+	for rows.Next() {
+		var date string
+		record, err := scanReport(rows, &date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report record: %v", err)
+		}
+		records[date] = record
+	}
+	return records, rows.Err()
+}
+
+// GetReportStatus retrieves the validation status for a given ID and date, empty if no report was stored
+func (s *SQLDatabase) GetReportStatus(id, date string) (string, error) {
+	record, _, err := s.GetReportRecord(id, date)
+	return record.Status, err
+}
+
+// AddMeterReset appends a meter reset event to the reset history of a device
+func (s *SQLDatabase) AddMeterReset(id string, reset MeterReset) error {
+	_, err := s.exec(`INSERT INTO meter_resets (device_id, baseline, import_baseline, export_baseline, reset_at, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		id, reset.Baseline, reset.ImportBaseline, reset.ExportBaseline, formatSQLTime(reset.ResetAt), formatSQLTime(reset.RecordedAt))
+	if err != nil {
+		return fmt.Errorf("failed to store meter reset: %v", err)
+	}
+	return nil
+}
+
+// GetMeterResets returns all meter reset events of a device in the order they were recorded
+func (s *SQLDatabase) GetMeterResets(id string) ([]MeterReset, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT baseline, import_baseline, export_baseline, reset_at, recorded_at FROM meter_resets WHERE device_id = ? ORDER BY recorded_at`), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meter resets: %v", err)
+	}
+	defer rows.Close()
+
+	var resets []MeterReset
+	for rows.Next() {
+		var reset MeterReset
+		var resetAt, recordedAt string
+		if err := rows.Scan(&reset.Baseline, &reset.ImportBaseline, &reset.ExportBaseline, &resetAt, &recordedAt); err != nil {
+			return nil, fmt.Errorf("failed to read meter reset: %v", err)
+		}
+		if reset.ResetAt, err = parseSQLTime(resetAt); err != nil {
+			return nil, fmt.Errorf("failed to parse reset time: %v", err)
+		}
+		if reset.RecordedAt, err = parseSQLTime(recordedAt); err != nil {
+			return nil, fmt.Errorf("failed to parse reset time: %v", err)
+		}
+		resets = append(resets, reset)
+	}
+	return resets, rows.Err()
+}
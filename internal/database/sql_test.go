@@ -0,0 +1,146 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLDatabase(t *testing.T) *SQLDatabase {
+	db, err := NewSQLDatabase(DriverSQLite, filepath.Join(t.TempDir(), "devices.sqlite"))
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestSQLDatabase_Devices(t *testing.T) {
+	db := newTestSQLDatabase(t)
+
+	require.NoError(t, db.AddDevice("dev1", "liq1", "Plug", "plug", "plmnt1", "02ab"))
+	require.NoError(t, db.AddDevice("dev2", "liq1", "Inverter", "pv", "plmnt2", ""))
+
+	device, found, err := db.GetDevice("dev1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "Plug", device.DeviceName)
+	assert.Equal(t, "02ab", device.PublicKey)
+	assert.WithinDuration(t, time.Now(), device.Timestamp, time.Minute)
+
+	_, found, err = db.GetDevice("unknown")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	devices, err := db.GetByLiquidAddress("liq1")
+	require.NoError(t, err)
+	assert.Len(t, devices, 2)
+	devices, err = db.GetByDeviceType("pv")
+	require.NoError(t, err)
+	assert.Len(t, devices, 1)
+	assert.Contains(t, devices, "dev2")
+
+	updated, err := db.UpdateDevice("dev1", "", "Kitchen Plug", "", "", "", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "Kitchen Plug", updated.DeviceName)
+	require.NoError(t, db.DeleteDevice("dev1", "bob"))
+	assert.ErrorIs(t, db.DeleteDevice("dev1", "bob"), ErrDeviceNotFound)
+
+	history, err := db.GetDeviceHistory("dev1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, DeviceChangeUpdate, history[0].Action)
+	assert.Equal(t, []string{"device_name"}, history[0].Fields)
+	assert.Equal(t, "Plug", history[0].Previous.DeviceName)
+	assert.Equal(t, DeviceChangeDelete, history[1].Action)
+	assert.Equal(t, "bob", history[1].ChangedBy)
+
+	devices, err = db.GetAllDevices()
+	require.NoError(t, err)
+	assert.Len(t, devices, 1)
+}
+
+func TestSQLDatabase_Reports(t *testing.T) {
+	db := newTestSQLDatabase(t)
+	record := ReportRecord{
+		Status:      ReportStatusValid,
+		ReceivedAt:  time.Date(2025, 6, 5, 0, 5, 0, 0, time.UTC),
+		Source:      "http",
+		Signature:   "verified",
+		InfluxWrite: InfluxWritePending,
+	}
+
+	claimed, err := db.ClaimReport("dev1", "2025-06-04", record, nil)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = db.ClaimReport("dev1", "2025-06-04", record, nil)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	record.InfluxWrite = InfluxWriteWritten
+	require.NoError(t, db.SetReportRecord("dev1", "2025-06-04", record))
+	require.NoError(t, db.SetReportRecord("dev1", "2025-06-06", ReportRecord{Status: ReportStatusInvalid, Reason: "energy data is not increasing"}))
+
+	stored, found, err := db.GetReportRecord("dev1", "2025-06-04")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, record, stored)
+	status, err := db.GetReportStatus("dev1", "2025-06-05")
+	require.NoError(t, err)
+	assert.Empty(t, status)
+
+	records, err := db.GetReportRecords("dev1", "2025-06-01", "2025-06-05")
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	importBaseline := 7.5
+	reset := MeterReset{Baseline: 2, ImportBaseline: &importBaseline, ResetAt: time.Date(2025, 6, 3, 20, 0, 0, 0, time.UTC), RecordedAt: time.Date(2025, 6, 3, 21, 0, 0, 0, time.UTC)}
+	require.NoError(t, db.AddMeterReset("dev1", reset))
+	resets, err := db.GetMeterResets("dev1")
+	require.NoError(t, err)
+	assert.Equal(t, []MeterReset{reset}, resets)
+
+	previous := LastReading{Timestamp: time.Date(2025, 6, 4, 23, 45, 0, 0, time.UTC), EnergyKWh: 12}
+	claimed, err = db.ClaimReport("dev1", "2025-06-07", ReportRecord{Status: ReportStatusValid, InfluxWrite: InfluxWritePending}, &LastReading{EnergyKWh: 13})
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	pending, err := db.GetPendingInfluxWrites()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"dev1": {"2025-06-07"}}, pending)
+
+	require.NoError(t, db.ReleaseReport("dev1", "2025-06-07", &previous))
+	status, err = db.GetReportStatus("dev1", "2025-06-07")
+	require.NoError(t, err)
+	assert.Empty(t, status)
+	last, found, err := db.GetLastReading("dev1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, previous.EnergyKWh, last.EnergyKWh)
+}
+
+func TestSQLDatabase_Migrations(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "devices.sqlite")
+	db, err := NewSQLDatabase(DriverSQLite, dsn)
+	require.NoError(t, err)
+	require.NoError(t, db.AddDevice("dev1", "liq1", "Plug", "plug", "plmnt1", ""))
+	db.Close()
+
+	// reopening applies no migration twice and keeps the data
+	db, err = NewSQLDatabase(DriverSQLite, dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, len(sqlMigrations), version)
+	_, found, err := db.GetDevice("dev1")
+	require.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestSQLDatabase_Rebind(t *testing.T) {
+	db := &SQLDatabase{driver: DriverPostgres}
+	assert.Equal(t, "SELECT a FROM b WHERE c = $1 AND d = $2", db.rebind("SELECT a FROM b WHERE c = ? AND d = ?"))
+	db.driver = DriverSQLite
+	assert.Equal(t, "SELECT a FROM b WHERE c = ?", db.rebind("SELECT a FROM b WHERE c = ?"))
+}
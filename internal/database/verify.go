@@ -0,0 +1,156 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verify checks every entry of the store against the key schema in keys.go: keys must be
+// well-formed, values must decode into their types and index entries must match their devices.
+// It returns one message per problem found.
+func (db *Database) Verify() ([]string, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	snapshot, err := db.db.GetSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %v", err)
+	}
+	defer snapshot.Release()
+
+	var problems []string
+	report := func(key []byte, format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%q: %s", key, fmt.Sprintf(format, args...)))
+	}
+	getDevice := func(zigbeeID string) (Device, bool) {
+		var device Device
+		data, err := snapshot.Get(keyForZigbeeID(zigbeeID), nil)
+		if err != nil {
+			return device, false
+		}
+		return device, json.Unmarshal(data, &device) == nil
+	}
+
+	iter := snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		k := string(key)
+		switch {
+		case strings.HasPrefix(k, devicePrefix):
+			zigbeeID := strings.TrimPrefix(k, devicePrefix)
+			var device Device
+			if zigbeeID == "" {
+				report(key, "empty device ID")
+			} else if err := json.Unmarshal(value, &device); err != nil {
+				report(key, "invalid device record: %v", err)
+			} else {
+				for _, indexKey := range indexKeys(zigbeeID, device) {
+					if ok, _ := snapshot.Has(indexKey, nil); !ok {
+						report(key, "missing index entry %q", indexKey)
+					}
+				}
+			}
+
+		case strings.HasPrefix(k, indexKeyPrefix):
+			index, rest, _ := strings.Cut(strings.TrimPrefix(k, indexKeyPrefix), "/")
+			value, zigbeeID, found := strings.Cut(rest, "\x00")
+			if !found || zigbeeID == "" {
+				report(key, "malformed index key")
+				continue
+			}
+			device, ok := getDevice(zigbeeID)
+			if !ok {
+				report(key, "index entry of unknown device %s", zigbeeID)
+				continue
+			}
+			var expected string
+			switch index {
+			case indexLiquidAddress:
+				expected = device.LiquidAddress
+			case indexPlanetmintAddress:
+				expected = device.PlanetmintAddress
+			case indexDeviceType:
+				expected = device.DeviceType
+			default:
+				report(key, "unknown index %s", index)
+				continue
+			}
+			if value != expected {
+				report(key, "stale index entry, device %s has %s %q", zigbeeID, index, expected)
+			}
+
+		case strings.HasPrefix(k, historyKeyPrefix):
+			zigbeeID, at, found := strings.Cut(strings.TrimPrefix(k, historyKeyPrefix), "/")
+			var change DeviceChange
+			if !found || zigbeeID == "" || len(at) != 20 || !isDigits(at) {
+				report(key, "malformed history key")
+			} else if err := json.Unmarshal(value, &change); err != nil {
+				report(key, "invalid history entry: %v", err)
+			}
+
+		case strings.HasPrefix(k, reportKeyPrefix):
+			if !isDateKey(strings.TrimPrefix(k, reportKeyPrefix)) {
+				report(key, "malformed report key")
+			} else if record, err := decodeReportRecord(value); err != nil {
+				report(key, "invalid report record: %v", err)
+			} else if record.Status != ReportStatusValid && record.Status != ReportStatusInvalid {
+				report(key, "unknown report status %q", record.Status)
+			}
+
+		case strings.HasPrefix(k, resetKeyPrefix):
+			var resets []MeterReset
+			if strings.TrimPrefix(k, resetKeyPrefix) == "" {
+				report(key, "empty device ID")
+			} else if err := json.Unmarshal(value, &resets); err != nil {
+				report(key, "invalid meter resets: %v", err)
+			}
+
+		case strings.HasPrefix(k, readingKeyPrefix):
+			var reading LastReading
+			if strings.TrimPrefix(k, readingKeyPrefix) == "" {
+				report(key, "empty device ID")
+			} else if err := json.Unmarshal(value, &reading); err != nil {
+				report(key, "invalid last reading: %v", err)
+			}
+
+		case k == schemaVersionKey:
+			version, err := strconv.Atoi(string(value))
+			if err != nil {
+				report(key, "invalid schema version %q", value)
+			} else if version != len(keyMigrations) {
+				report(key, "schema version %d, expected %d", version, len(keyMigrations))
+			}
+
+		default:
+			report(key, "unknown key")
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return problems, fmt.Errorf("iterator error: %v", err)
+	}
+
+	if ok, err := snapshot.Has([]byte(schemaVersionKey), nil); err != nil {
+		return problems, err
+	} else if !ok {
+		problems = append(problems, fmt.Sprintf("%q: missing schema version", schemaVersionKey))
+	}
+	return problems, nil
+}
+
+// isDateKey checks that s has the form <id>/<YYYY-MM-DD>
+func isDateKey(s string) bool {
+	i := strings.LastIndexByte(s, '/')
+	if i <= 0 {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", s[i+1:])
+	return err == nil
+}
+
+func isDigits(s string) bool {
+	return strings.TrimLeft(s, "0123456789") == ""
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rddl-network/energy-service/internal/config"
+)
+
+func TestVerify(t *testing.T) {
+	db, err := NewDatabase(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.AddDevice("dev1", "liq1", "Plug", "plug", "plmnt1", ""))
+	_, err = db.UpdateDevice("dev1", "liq2", "", "", "", "", "test")
+	require.NoError(t, err)
+	require.NoError(t, db.SetReportRecord("dev1", "2025-06-04", ReportRecord{Status: ReportStatusValid, Signature: "verified"}))
+	require.NoError(t, db.AddMeterReset("dev1", MeterReset{Baseline: 1, ResetAt: time.Now()}))
+
+	problems, err := db.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	require.NoError(t, db.db.Put(keyForZigbeeID("dev2"), []byte("not json"), nil))
+	require.NoError(t, db.db.Put(append(indexPrefix(indexLiquidAddress, "liq1"), "dev1"...), nil, nil))
+	require.NoError(t, db.db.Put([]byte("report/dev1/yesterday"), []byte(`{"status":"valid"}`), nil))
+	require.NoError(t, db.db.Put([]byte("report/dev1/2025-06-05"), []byte(`{"status":"unknown"}`), nil))
+	require.NoError(t, db.db.Put([]byte("stray"), []byte("x"), nil))
+
+	problems, err = db.Verify()
+	require.NoError(t, err)
+	assert.Len(t, problems, 5)
+	assert.Contains(t, problems[0], "invalid device record")
+	assert.Contains(t, problems[1], "stale index entry")
+	assert.Contains(t, problems[2], "unknown report status")
+	assert.Contains(t, problems[3], "malformed report key")
+	assert.Contains(t, problems[4], "unknown key")
+}
+
+func TestPutDeviceAndDeleteReport(t *testing.T) {
+	db, err := NewDatabase(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")})
+	require.NoError(t, err)
+	defer db.Close()
+
+	registered := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, db.PutDevice("dev1", Device{LiquidAddress: "liq1", DeviceType: "plug", Timestamp: registered}))
+	device, found, err := db.GetDevice("dev1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, registered.Equal(device.Timestamp))
+	devices, err := db.GetByDeviceType("plug")
+	require.NoError(t, err)
+	assert.Contains(t, devices, "dev1")
+
+	require.NoError(t, db.SetReportRecord("dev1", "2025-06-04", ReportRecord{Status: ReportStatusValid, Signature: "verified"}))
+	require.NoError(t, db.SetLastReading("dev1", LastReading{Timestamp: time.Date(2025, 6, 4, 21, 45, 0, 0, time.UTC), EnergyKWh: 12}))
+	deleted, err := db.DeleteReport("dev1", "2025-06-04")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	_, found, err = db.GetLastReading("dev1")
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, found, err = db.GetReportRecord("dev1", "2025-06-04")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	deleted, err = db.DeleteReport("dev1", "2025-06-04")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	require.NoError(t, db.Compact())
+}
+
+func TestReleaseReport(t *testing.T) {
+	db, err := NewDatabase(config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "devices.db")})
+	require.NoError(t, err)
+	defer db.Close()
+
+	claimed, err := db.ClaimReport("dev1", "2025-06-04", ReportRecord{Status: ReportStatusValid, Signature: "verified", InfluxWrite: InfluxWritePending}, &LastReading{EnergyKWh: 13})
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	pending, err := db.GetPendingInfluxWrites()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"dev1": {"2025-06-04"}}, pending)
+
+	// without a previous reading the reading is removed
+	require.NoError(t, db.ReleaseReport("dev1", "2025-06-04", nil))
+	_, found, err := db.GetReportRecord("dev1", "2025-06-04")
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, found, err = db.GetLastReading("dev1")
+	require.NoError(t, err)
+	assert.False(t, found)
+	pending, err = db.GetPendingInfluxWrites()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
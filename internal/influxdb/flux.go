@@ -0,0 +1,120 @@
+package influxdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FluxQuery builds a Flux pipeline. Strings such as the bucket, the measurement and tags are
+// always written as escaped string literals, so values taken from requests cannot change the query.
+type FluxQuery struct {
+	stages []string
+	err    error
+}
+
+// From starts a query reading the bucket
+func From(bucket string) *FluxQuery {
+	return &FluxQuery{stages: []string{"from(bucket: " + fluxString(bucket) + ")"}}
+}
+
+// Range limits the query to points from start (inclusive) to stop (exclusive)
+func (q *FluxQuery) Range(start, stop time.Time) *FluxQuery {
+	return q.pipe("range(start: " + fluxTime(start) + ", stop: " + fluxTime(stop) + ")")
+}
+
+// RangeFrom limits the query to points from start on
+func (q *FluxQuery) RangeFrom(start time.Time) *FluxQuery {
+	return q.pipe("range(start: " + fluxTime(start) + ")")
+}
+
+// Filter keeps the points of the measurement having all tags
+func (q *FluxQuery) Filter(measurement string, tags map[string]string) *FluxQuery {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	predicate := `r["_measurement"] == ` + fluxString(measurement)
+	for _, k := range keys {
+		predicate += " and r[" + fluxString(k) + "] == " + fluxString(tags[k])
+	}
+	return q.pipe("filter(fn: (r) => " + predicate + ")")
+}
+
+// TimeShift moves the points and the range bounds of every table by d
+func (q *FluxQuery) TimeShift(d time.Duration) *FluxQuery {
+	return q.pipe(fmt.Sprintf("timeShift(duration: %dns)", int64(d)))
+}
+
+// Last keeps the last point of every table
+func (q *FluxQuery) Last() *FluxQuery {
+	return q.pipe("last()")
+}
+
+// AggregateWindow aggregates the points into windows of length every with one of the Aggregate functions
+func (q *FluxQuery) AggregateWindow(every time.Duration, aggregate string) *FluxQuery {
+	switch aggregate {
+	case AggregateLast, AggregateMax, AggregateMean, AggregateSum:
+	default:
+		q.fail(fmt.Errorf("unsupported aggregate %q", aggregate))
+		return q
+	}
+	if every < time.Second {
+		q.fail(fmt.Errorf("window %s is shorter than a second", every))
+		return q
+	}
+	return q.pipe("aggregateWindow(every: " + fluxDuration(every) + ", fn: " + aggregate + ", createEmpty: false)")
+}
+
+// Build returns the Flux source of the query, or the first error of a stage
+func (q *FluxQuery) Build() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	return strings.Join(q.stages, "\n  |> "), nil
+}
+
+func (q *FluxQuery) pipe(stage string) *FluxQuery {
+	q.stages = append(q.stages, stage)
+	return q
+}
+
+func (q *FluxQuery) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// MeasurementsQuery returns a query listing the measurements of the bucket
+func MeasurementsQuery(bucket string) string {
+	return "import \"influxdata/influxdb/schema\"\nschema.measurements(bucket: " + fluxString(bucket) + ")"
+}
+
+// fluxEscaper escapes the characters with a meaning inside Flux string literals,
+// ${ would start an interpolation
+var fluxEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"${", `\${`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// fluxString returns s as a Flux string literal
+func fluxString(s string) string {
+	return `"` + fluxEscaper.Replace(s) + `"`
+}
+
+// fluxTime returns t as a Flux time literal
+func fluxTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// fluxDuration returns d in whole seconds as a Flux duration literal
+func fluxDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
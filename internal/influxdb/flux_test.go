@@ -0,0 +1,125 @@
+package influxdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stringLiterals returns the decoded string literals of Flux source and the source with every
+// literal replaced by "", failing on escapes Flux does not know
+func stringLiterals(t *testing.T, flux string) ([]string, string) {
+	var literals []string
+	var rest strings.Builder
+	for i := 0; i < len(flux); i++ {
+		if flux[i] != '"' {
+			rest.WriteByte(flux[i])
+			continue
+		}
+		var literal strings.Builder
+		for i++; ; i++ {
+			require.Less(t, i, len(flux), "unterminated string literal")
+			if flux[i] == '"' {
+				break
+			}
+			if flux[i] == '$' && i+1 < len(flux) && flux[i+1] == '{' {
+				t.Fatalf("unescaped interpolation in %s", flux)
+			}
+			if flux[i] == '\\' {
+				i++
+				switch {
+				case flux[i] == 'n':
+					literal.WriteByte('\n')
+				case flux[i] == 'r':
+					literal.WriteByte('\r')
+				case flux[i] == 't':
+					literal.WriteByte('\t')
+				case flux[i] == '\\' || flux[i] == '"':
+					literal.WriteByte(flux[i])
+				case strings.HasPrefix(flux[i:], "${"):
+					literal.WriteString("${")
+					i++
+				default:
+					t.Fatalf("invalid escape \\%c in %s", flux[i], flux)
+				}
+				continue
+			}
+			literal.WriteByte(flux[i])
+		}
+		literals = append(literals, literal.String())
+		rest.WriteString(`""`)
+	}
+	return literals, rest.String()
+}
+
+func TestFluxQuery(t *testing.T) {
+	from := time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC)
+	flux, err := From("energy").Range(from, from.Add(time.Hour)).
+		Filter("energy_data", map[string]string{"timezone": "Europe/Vienna", "Inspelning": "12345"}).
+		AggregateWindow(15*time.Minute, AggregateLast).Build()
+	require.NoError(t, err)
+	assert.Equal(t, `from(bucket: "energy")
+  |> range(start: 2025-06-04T00:00:00Z, stop: 2025-06-04T01:00:00Z)
+  |> filter(fn: (r) => r["_measurement"] == "energy_data" and r["Inspelning"] == "12345" and r["timezone"] == "Europe/Vienna")
+  |> aggregateWindow(every: 900s, fn: last, createEmpty: false)`, flux)
+
+	flux, err = From("energy").Range(from.Add(time.Nanosecond), from.Add(time.Hour+time.Nanosecond)).Filter("energy_data", nil).
+		TimeShift(-time.Nanosecond).AggregateWindow(time.Hour, AggregateLast).Build()
+	require.NoError(t, err)
+	assert.Equal(t, `from(bucket: "energy")
+  |> range(start: 2025-06-04T00:00:00.000000001Z, stop: 2025-06-04T01:00:00.000000001Z)
+  |> filter(fn: (r) => r["_measurement"] == "energy_data")
+  |> timeShift(duration: -1ns)
+  |> aggregateWindow(every: 3600s, fn: last, createEmpty: false)`, flux)
+
+	flux, err = From("energy").RangeFrom(time.Unix(0, 0)).Filter("energy_data", nil).Last().Build()
+	require.NoError(t, err)
+	assert.Equal(t, `from(bucket: "energy")
+  |> range(start: 1970-01-01T00:00:00Z)
+  |> filter(fn: (r) => r["_measurement"] == "energy_data")
+  |> last()`, flux)
+}
+
+func TestFluxQuery_HostileValues(t *testing.T) {
+	hostile := []string{
+		`Europe/Vienna") |> drop(columns: ["_value"]) //`,
+		`\") |> yield() //`,
+		`${string(v: 1)}`,
+		`\${x}`,
+		"line\nbreak\r\ttab",
+		`"`,
+		`\`,
+		`$`,
+	}
+	for _, value := range hostile {
+		flux, err := From(value).RangeFrom(time.Unix(0, 0)).
+			Filter(value, map[string]string{"Inspelning": "12345", "timezone": value}).Last().Build()
+		require.NoError(t, err)
+
+		literals, structure := stringLiterals(t, flux)
+		assert.Equal(t, []string{value, "_measurement", value, "Inspelning", "12345", "timezone", value}, literals, flux)
+		assert.Equal(t, `from(bucket: "")
+  |> range(start: 1970-01-01T00:00:00Z)
+  |> filter(fn: (r) => r[""] == "" and r[""] == "" and r[""] == "")
+  |> last()`, structure)
+
+		// tag keys are escaped as well
+		flux, err = From("energy").Filter("energy_data", map[string]string{value: "12345"}).Build()
+		require.NoError(t, err)
+		literals, _ = stringLiterals(t, flux)
+		assert.Equal(t, []string{"energy", "_measurement", "energy_data", value, "12345"}, literals, flux)
+
+		literals, _ = stringLiterals(t, MeasurementsQuery(value))
+		assert.Equal(t, []string{"influxdata/influxdb/schema", value}, literals)
+	}
+}
+
+func TestFluxQuery_InvalidAggregate(t *testing.T) {
+	_, err := From("energy").Filter("energy_data", nil).AggregateWindow(time.Hour, "last) |> drop(").Build()
+	assert.Error(t, err)
+	_, err = From("energy").Filter("energy_data", nil).AggregateWindow(time.Millisecond, AggregateLast).Build()
+	assert.Error(t, err)
+}
@@ -5,7 +5,13 @@ import (
 	"time"
 )
 
-type Point interface{}
+// Point is a single point of a batch written with WritePoints
+type Point struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Fields      map[string]interface{} `json:"fields"`
+	Timestamp   time.Time              `json:"timestamp"`
+}
 
 type LastPointResult struct {
 	Timestamp time.Time
@@ -13,7 +19,28 @@ type LastPointResult struct {
 	Tags      map[string]string
 }
 
+// RangePoint is a window of a range query with the aggregated value of each field,
+// the timestamp is the end of the window
+type RangePoint struct {
+	Timestamp time.Time
+	Fields    map[string]interface{}
+}
+
+// Aggregates of a range query, named after the Flux functions
+const (
+	AggregateLast = "last"
+	AggregateMax  = "max"
+	AggregateMean = "mean"
+	AggregateSum  = "sum"
+)
+
 type Client interface {
 	WritePoint(ctx context.Context, measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time) error
+	// WritePoints writes all points in one request, so they are either all stored or none
+	WritePoints(ctx context.Context, points []Point) error
 	GetLastPoint(ctx context.Context, measurement string, tags map[string]string) (*LastPointResult, error)
+	// QueryRange aggregates the points after from up to and including to into windows (start, stop] of
+	// the given length, stamped with their stop and ordered by time. A reading stamped at the end of a
+	// window belongs to it. Windows without points are left out.
+	QueryRange(ctx context.Context, measurement string, tags map[string]string, from, to time.Time, every time.Duration, aggregate string) ([]RangePoint, error)
 }
@@ -2,6 +2,7 @@ package influxdb
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go"
@@ -39,15 +40,25 @@ func (c *LocalInfluxClient) WritePointTyped(ctx context.Context, measurement str
 	return c.writeAPI.WritePoint(ctx, p)
 }
 
+// WritePoints writes the points as a single line protocol request
+func (c *LocalInfluxClient) WritePoints(ctx context.Context, points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	batch := make([]*write.Point, len(points))
+	for i, p := range points {
+		batch[i] = write.NewPoint(p.Measurement, p.Tags, p.Fields, p.Timestamp)
+	}
+	return c.writeAPI.WritePoint(ctx, batch...)
+}
+
 func (c *LocalInfluxClient) GetLastPoint(ctx context.Context, measurement string, tags map[string]string) (*LastPointResult, error) {
-	// Compose Flux query to get the last point for the given tags
-	flux := `from(bucket: "` + c.bucket + `")` +
-		`|> range(start: -30d)` +
-		`|> filter(fn: (r) => r["_measurement"] == "` + measurement + `"`
-	for k, v := range tags {
-		flux += ` and r["` + k + `"] == "` + v + `"`
+	// Compose Flux query to get the last point for the given tags, it is only used to rebuild
+	// the cached last readings, so the whole bucket is searched
+	flux, err := From(c.bucket).RangeFrom(time.Unix(0, 0)).Filter(measurement, tags).Last().Build()
+	if err != nil {
+		return nil, err
 	}
-	flux += `)|> last()`
 	result, err := c.queryAPI.Query(ctx, flux)
 	if err != nil {
 		return nil, err
@@ -78,3 +89,39 @@ func (c *LocalInfluxClient) GetLastPoint(ctx context.Context, measurement string
 	}
 	return last, nil
 }
+
+func (c *LocalInfluxClient) QueryRange(ctx context.Context, measurement string, tags map[string]string, from, to time.Time, every time.Duration, aggregate string) ([]RangePoint, error) {
+	// a reading belongs to the window ending at its timestamp: moving the range and the points back by
+	// a nanosecond turns the [start, stop) windows of aggregateWindow into (start, stop]
+	flux, err := From(c.bucket).Range(from.Add(time.Nanosecond), to.Add(time.Nanosecond)).Filter(measurement, tags).
+		TimeShift(-time.Nanosecond).AggregateWindow(every, aggregate).Build()
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.queryAPI.Query(ctx, flux)
+	if err != nil {
+		return nil, err
+	}
+
+	// every field is a table of its own, merge the rows of all fields by window
+	windows := make(map[time.Time]*RangePoint)
+	for result.Next() {
+		record := result.Record()
+		point, ok := windows[record.Time()]
+		if !ok {
+			point = &RangePoint{Timestamp: record.Time(), Fields: make(map[string]interface{})}
+			windows[record.Time()] = point
+		}
+		point.Fields[record.Field()] = record.Value()
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	points := make([]RangePoint, 0, len(windows))
+	for _, point := range windows {
+		points = append(points, *point)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+	return points, nil
+}
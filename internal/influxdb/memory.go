@@ -0,0 +1,368 @@
+package influxdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryClient implements the influxdb.Client interface in memory, for development and tests
+// without an InfluxDB. Points are grouped into series by measurement and tags like in InfluxDB,
+// a point written to the same series and timestamp again replaces the values of its fields.
+// With a file the points are loaded on start and saved after every write; field values are
+// stored as JSON and numbers are read back as float64.
+type MemoryClient struct {
+	mu     sync.RWMutex
+	file   string
+	series map[string]*memorySeries
+}
+
+type memorySeries struct {
+	measurement string
+	tags        map[string]string
+	points      []memoryPoint // ordered by time
+}
+
+type memoryPoint struct {
+	timestamp time.Time
+	fields    map[string]interface{}
+}
+
+// NewMemoryClient returns an empty in-memory client, or loads the points saved in file if it is set
+func NewMemoryClient(file string) (*MemoryClient, error) {
+	c := &MemoryClient{
+		file:   file,
+		series: make(map[string]*memorySeries),
+	}
+	if file == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var points []Point
+	if err := json.Unmarshal(data, &points); err != nil {
+		return nil, fmt.Errorf("failed to load points from %s: %v", file, err)
+	}
+	for _, p := range points {
+		c.insert(p)
+	}
+	return c, nil
+}
+
+// seriesKey identifies a series by its measurement and tags, tags are sorted by key
+func seriesKey(measurement string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(measurement)
+	for _, k := range keys {
+		b.WriteString("\x00" + k + "=" + tags[k])
+	}
+	return b.String()
+}
+
+func (c *MemoryClient) insert(p Point) {
+	key := seriesKey(p.Measurement, p.Tags)
+	s, ok := c.series[key]
+	if !ok {
+		tags := make(map[string]string, len(p.Tags))
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		s = &memorySeries{measurement: p.Measurement, tags: tags}
+		c.series[key] = s
+	}
+	ts := p.Timestamp.UTC()
+	i := sort.Search(len(s.points), func(i int) bool { return !s.points[i].timestamp.Before(ts) })
+	if i < len(s.points) && s.points[i].timestamp.Equal(ts) {
+		for k, v := range p.Fields {
+			s.points[i].fields[k] = v
+		}
+		return
+	}
+	fields := make(map[string]interface{}, len(p.Fields))
+	for k, v := range p.Fields {
+		fields[k] = v
+	}
+	s.points = append(s.points, memoryPoint{})
+	copy(s.points[i+1:], s.points[i:])
+	s.points[i] = memoryPoint{timestamp: ts, fields: fields}
+}
+
+// save writes all points to the file, replacing it atomically
+func (c *MemoryClient) save() error {
+	if c.file == "" {
+		return nil
+	}
+	var points []Point
+	for _, s := range c.series {
+		for _, p := range s.points {
+			points = append(points, Point{Measurement: s.measurement, Tags: s.tags, Fields: p.fields, Timestamp: p.timestamp})
+		}
+	}
+	data, err := json.Marshal(points)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), filepath.Base(c.file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.file)
+}
+
+func (c *MemoryClient) WritePoint(ctx context.Context, measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	return c.WritePoints(ctx, []Point{{Measurement: measurement, Tags: tags, Fields: fields, Timestamp: ts}})
+}
+
+// WritePoints stores all points, with a file they are only kept if the file could be saved
+func (c *MemoryClient) WritePoints(ctx context.Context, points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	for _, p := range points {
+		if p.Measurement == "" || len(p.Fields) == 0 {
+			return fmt.Errorf("point at %s needs a measurement and at least one field", p.Timestamp)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == "" {
+		for _, p := range points {
+			c.insert(p)
+		}
+		return nil
+	}
+
+	// keep the previous state to roll back, so memory and file do not drift apart
+	previous := c.series
+	c.series = make(map[string]*memorySeries, len(previous))
+	for key, s := range previous {
+		clone := *s
+		clone.points = make([]memoryPoint, len(s.points))
+		for i, p := range s.points {
+			fields := make(map[string]interface{}, len(p.fields))
+			for k, v := range p.fields {
+				fields[k] = v
+			}
+			clone.points[i] = memoryPoint{timestamp: p.timestamp, fields: fields}
+		}
+		c.series[key] = &clone
+	}
+	for _, p := range points {
+		c.insert(p)
+	}
+	if err := c.save(); err != nil {
+		c.series = previous
+		return fmt.Errorf("failed to save points to %s: %v", c.file, err)
+	}
+	return nil
+}
+
+// matching returns the series of measurement that have all the given tags
+func (c *MemoryClient) matching(measurement string, tags map[string]string) []*memorySeries {
+	var matches []*memorySeries
+	for _, s := range c.series {
+		if s.measurement != measurement {
+			continue
+		}
+		match := true
+		for k, v := range tags {
+			if s.tags[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			matches = append(matches, s)
+		}
+	}
+	return matches
+}
+
+// GetLastPoint returns the last value of every field of the matching series at the time of the
+// newest of them, with the tags of the series it belongs to
+func (c *MemoryClient) GetLastPoint(ctx context.Context, measurement string, tags map[string]string) (*LastPointResult, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var last *LastPointResult
+	fieldTimes := make(map[string]time.Time)
+	for _, s := range c.matching(measurement, tags) {
+		for _, p := range s.points {
+			if last == nil {
+				last = &LastPointResult{Fields: make(map[string]interface{})}
+			}
+			for k, v := range p.fields {
+				if t, seen := fieldTimes[k]; !seen || p.timestamp.After(t) {
+					fieldTimes[k] = p.timestamp
+					last.Fields[k] = v
+				}
+			}
+			if last.Tags == nil || p.timestamp.After(last.Timestamp) {
+				last.Timestamp = p.timestamp
+				last.Tags = map[string]string{"_measurement": s.measurement}
+				for k, v := range s.tags {
+					last.Tags[k] = v
+				}
+			}
+		}
+	}
+	return last, nil
+}
+
+// QueryRange aggregates the points of all matching series like aggregateWindow does in Flux:
+// windows (start, stop] are aligned to the Unix epoch and stamped with their stop, clipped to to
+func (c *MemoryClient) QueryRange(ctx context.Context, measurement string, tags map[string]string, from, to time.Time, every time.Duration, aggregate string) ([]RangePoint, error) {
+	if every <= 0 {
+		return nil, fmt.Errorf("invalid window %s", every)
+	}
+	reduce, ok := memoryAggregates[aggregate]
+	if !ok {
+		return nil, fmt.Errorf("unsupported aggregate %q", aggregate)
+	}
+
+	c.mu.RLock()
+	// values of each field by window start, in time order within a series
+	type sample struct {
+		timestamp time.Time
+		value     interface{}
+	}
+	windows := make(map[time.Time]map[string][]sample)
+	for _, s := range c.matching(measurement, tags) {
+		for _, p := range s.points {
+			if !p.timestamp.After(from) || p.timestamp.After(to) {
+				continue
+			}
+			// a point at the end of a window belongs to it
+			start := windowStart(p.timestamp.Add(-time.Nanosecond), every)
+			if windows[start] == nil {
+				windows[start] = make(map[string][]sample)
+			}
+			for k, v := range p.fields {
+				windows[start][k] = append(windows[start][k], sample{p.timestamp, v})
+			}
+		}
+	}
+	c.mu.RUnlock()
+
+	points := make([]RangePoint, 0, len(windows))
+	for start, fields := range windows {
+		stop := start.Add(every)
+		if stop.After(to) {
+			stop = to
+		}
+		point := RangePoint{Timestamp: stop.UTC(), Fields: make(map[string]interface{})}
+		for field, samples := range fields {
+			sort.SliceStable(samples, func(i, j int) bool { return samples[i].timestamp.Before(samples[j].timestamp) })
+			values := make([]interface{}, len(samples))
+			for i, s := range samples {
+				values[i] = s.value
+			}
+			if value, ok := reduce(values); ok {
+				point.Fields[field] = value
+			}
+		}
+		if len(point.Fields) > 0 {
+			points = append(points, point)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+	return points, nil
+}
+
+// windowStart returns the start of the window of length every that contains t, counted from the Unix epoch
+func windowStart(t time.Time, every time.Duration) time.Time {
+	offset := time.Duration(t.UnixNano() % int64(every))
+	if offset < 0 {
+		offset += every
+	}
+	return t.Add(-offset).UTC()
+}
+
+// memoryAggregates reduce the values of a field in a window, ordered by time.
+// Fields that are not numeric are left out of max, mean and sum.
+var memoryAggregates = map[string]func(values []interface{}) (interface{}, bool){
+	AggregateLast: func(values []interface{}) (interface{}, bool) {
+		return values[len(values)-1], true
+	},
+	AggregateMax: func(values []interface{}) (interface{}, bool) {
+		numbers, ok := toFloats(values)
+		if !ok {
+			return nil, false
+		}
+		max := numbers[0]
+		for _, v := range numbers[1:] {
+			if v > max {
+				max = v
+			}
+		}
+		return max, true
+	},
+	AggregateMean: func(values []interface{}) (interface{}, bool) {
+		numbers, ok := toFloats(values)
+		if !ok {
+			return nil, false
+		}
+		sum := 0.0
+		for _, v := range numbers {
+			sum += v
+		}
+		return sum / float64(len(numbers)), true
+	},
+	AggregateSum: func(values []interface{}) (interface{}, bool) {
+		numbers, ok := toFloats(values)
+		if !ok {
+			return nil, false
+		}
+		sum := 0.0
+		for _, v := range numbers {
+			sum += v
+		}
+		return sum, true
+	},
+}
+
+func toFloats(values []interface{}) ([]float64, bool) {
+	numbers := make([]float64, len(values))
+	for i, v := range values {
+		switch n := v.(type) {
+		case float64:
+			numbers[i] = n
+		case float32:
+			numbers[i] = float64(n)
+		case int:
+			numbers[i] = float64(n)
+		case int64:
+			numbers[i] = float64(n)
+		case uint64:
+			numbers[i] = float64(n)
+		default:
+			return nil, false
+		}
+	}
+	return numbers, true
+}
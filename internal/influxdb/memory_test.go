@@ -0,0 +1,133 @@
+package influxdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var memoryStart = time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC)
+
+// writeIntervals writes a cumulative energy value every 15 minutes, starting with value at memoryStart
+func writeIntervals(t *testing.T, c *MemoryClient, id string, n int, value float64) {
+	points := make([]Point, n)
+	for i := range points {
+		points[i] = Point{
+			Measurement: "energy_data",
+			Tags:        map[string]string{"Inspelning": id, "timezone": "Europe/Vienna"},
+			Fields:      map[string]interface{}{"energy_kwh": value + float64(i)},
+			Timestamp:   memoryStart.Add(time.Duration(i) * 15 * time.Minute),
+		}
+	}
+	require.NoError(t, c.WritePoints(context.Background(), points))
+}
+
+func TestMemoryClient_GetLastPoint(t *testing.T) {
+	c, err := NewMemoryClient("")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	last, err := c.GetLastPoint(ctx, "energy_data", map[string]string{"Inspelning": "zigbee1"})
+	require.NoError(t, err)
+	assert.Nil(t, last)
+
+	writeIntervals(t, c, "zigbee1", 8, 10)
+	writeIntervals(t, c, "zigbee2", 4, 100)
+	// the same series and timestamp again only replaces the fields it carries
+	require.NoError(t, c.WritePoint(ctx, "energy_data", map[string]string{"timezone": "Europe/Vienna", "Inspelning": "zigbee1"},
+		map[string]interface{}{"import_energy_kwh": 3.0}, memoryStart.Add(105*time.Minute)))
+	require.NoError(t, c.WritePoint(ctx, "device_status", map[string]string{"ID": "zigbee1"},
+		map[string]interface{}{"energy_kwh": 99.0}, memoryStart.Add(24*time.Hour)))
+
+	last, err = c.GetLastPoint(ctx, "energy_data", map[string]string{"Inspelning": "zigbee1"})
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, memoryStart.Add(105*time.Minute), last.Timestamp)
+	assert.Equal(t, map[string]interface{}{"energy_kwh": 17.0, "import_energy_kwh": 3.0}, last.Fields)
+	assert.Equal(t, "zigbee1", last.Tags["Inspelning"])
+	assert.Equal(t, "energy_data", last.Tags["_measurement"])
+
+	last, err = c.GetLastPoint(ctx, "energy_data", map[string]string{"Inspelning": "zigbee3"})
+	require.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestMemoryClient_QueryRange(t *testing.T) {
+	c, err := NewMemoryClient("")
+	require.NoError(t, err)
+	writeIntervals(t, c, "zigbee1", 8, 10)
+	writeIntervals(t, c, "zigbee2", 8, 100)
+	tags := map[string]string{"Inspelning": "zigbee1"}
+
+	tests := []struct {
+		aggregate string
+		want      []float64
+	}{
+		{AggregateLast, []float64{14, 17}},
+		{AggregateMax, []float64{14, 17}},
+		{AggregateMean, []float64{12.5, 16}},
+		{AggregateSum, []float64{50, 48}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.aggregate, func(t *testing.T) {
+			points, err := c.QueryRange(context.Background(), "energy_data", tags, memoryStart, memoryStart.Add(3*time.Hour), time.Hour, tt.aggregate)
+			require.NoError(t, err)
+			// windows (start, stop] are stamped with their stop, the point at from and the empty third hour are left out
+			require.Len(t, points, 2)
+			assert.Equal(t, memoryStart.Add(time.Hour), points[0].Timestamp)
+			assert.Equal(t, memoryStart.Add(2*time.Hour), points[1].Timestamp)
+			assert.Equal(t, tt.want[0], points[0].Fields["energy_kwh"])
+			assert.Equal(t, tt.want[1], points[1].Fields["energy_kwh"])
+		})
+	}
+
+	// the stop is inclusive and clips the last window
+	points, err := c.QueryRange(context.Background(), "energy_data", tags, memoryStart.Add(30*time.Minute), memoryStart.Add(90*time.Minute), time.Hour, AggregateLast)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, memoryStart.Add(time.Hour), points[0].Timestamp)
+	assert.Equal(t, 14.0, points[0].Fields["energy_kwh"])
+	assert.Equal(t, memoryStart.Add(90*time.Minute), points[1].Timestamp)
+	assert.Equal(t, 16.0, points[1].Fields["energy_kwh"])
+
+	// every window is labelled with the timestamp of its last reading
+	points, err = c.QueryRange(context.Background(), "energy_data", tags, memoryStart.Add(-15*time.Minute), memoryStart.Add(2*time.Hour), 15*time.Minute, AggregateLast)
+	require.NoError(t, err)
+	require.Len(t, points, 8)
+	for i, point := range points {
+		assert.Equal(t, memoryStart.Add(time.Duration(i)*15*time.Minute), point.Timestamp)
+		assert.Equal(t, 10.0+float64(i), point.Fields["energy_kwh"])
+	}
+
+	_, err = c.QueryRange(context.Background(), "energy_data", tags, memoryStart, memoryStart.Add(time.Hour), time.Hour, "median")
+	assert.Error(t, err)
+}
+
+func TestMemoryClient_File(t *testing.T) {
+	file := t.TempDir() + "/points.json"
+	c, err := NewMemoryClient(file)
+	require.NoError(t, err)
+	writeIntervals(t, c, "zigbee1", 4, 10)
+
+	reopened, err := NewMemoryClient(file)
+	require.NoError(t, err)
+	last, err := reopened.GetLastPoint(context.Background(), "energy_data", map[string]string{"Inspelning": "zigbee1", "timezone": "Europe/Vienna"})
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, memoryStart.Add(45*time.Minute), last.Timestamp)
+	assert.Equal(t, 13.0, last.Fields["energy_kwh"])
+
+	// a write that cannot be saved is not kept in memory either
+	c.file = t.TempDir() + "/missing/points.json"
+	assert.Error(t, c.WritePoint(context.Background(), "energy_data", map[string]string{"Inspelning": "zigbee1"},
+		map[string]interface{}{"energy_kwh": 20.0}, memoryStart.Add(24*time.Hour)))
+	last, err = c.GetLastPoint(context.Background(), "energy_data", map[string]string{"Inspelning": "zigbee1"})
+	require.NoError(t, err)
+	assert.Equal(t, 13.0, last.Fields["energy_kwh"])
+
+	_, err = NewMemoryClient(t.TempDir())
+	assert.Error(t, err, "a directory is not a points file")
+}
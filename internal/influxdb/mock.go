@@ -16,6 +16,11 @@ func (m *MockClient) WritePoint(ctx context.Context, measurement string, tags ma
 	return args.Error(0)
 }
 
+func (m *MockClient) WritePoints(ctx context.Context, points []Point) error {
+	args := m.Called(ctx, points)
+	return args.Error(0)
+}
+
 func (m *MockClient) GetLastPoint(ctx context.Context, measurement string, tags map[string]string) (*LastPointResult, error) {
 	args := m.Called(ctx, measurement, tags)
 	if args.Get(0) == nil {
@@ -23,3 +28,11 @@ func (m *MockClient) GetLastPoint(ctx context.Context, measurement string, tags
 	}
 	return args.Get(0).(*LastPointResult), args.Error(1)
 }
+
+func (m *MockClient) QueryRange(ctx context.Context, measurement string, tags map[string]string, from, to time.Time, every time.Duration, aggregate string) ([]RangePoint, error) {
+	args := m.Called(ctx, measurement, tags, from, to, every, aggregate)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]RangePoint), args.Error(1)
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnsupportedVersion is returned for payloads whose version has no registered decoder
+var ErrUnsupportedVersion = errors.New("unsupported payload version")
+
+// PayloadDecoder converts the raw JSON payload of one format version into the normalized EnergyData
+type PayloadDecoder func(payload []byte) (EnergyData, error)
+
+var (
+	decodersMutex sync.RWMutex
+	decoders      = map[int]PayloadDecoder{
+		1: decodeV1,
+		2: decodeV2,
+	}
+)
+
+// RegisterDecoder registers the decoder for a payload version, replacing any previous one
+func RegisterDecoder(version int, decoder PayloadDecoder) {
+	decodersMutex.Lock()
+	defer decodersMutex.Unlock()
+	decoders[version] = decoder
+}
+
+// DecodeEnergyData reads the version of a payload and decodes it with the matching decoder
+func DecodeEnergyData(payload []byte) (EnergyData, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return EnergyData{}, err
+	}
+
+	decodersMutex.RLock()
+	decoder, ok := decoders[header.Version]
+	decodersMutex.RUnlock()
+	if !ok {
+		return EnergyData{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.Version)
+	}
+	return decoder(payload)
+}
+
+// payloadV1 is the original payload format: one value per interval in kWh
+type payloadV1 struct {
+	Version      int    `json:"version"`
+	ID           string `json:"id"`
+	Date         string `json:"date"`
+	TimezoneName string `json:"timezone_name"`
+	Data         []struct {
+		Value     float64   `json:"value"`
+		Timestamp TimeStamp `json:"timestamp"`
+	} `json:"data"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// decodeV1 decodes the original payload format. Members that were added in version 2
+// (unit, import and export) are ignored, as they always were.
+func decodeV1(payload []byte) (EnergyData, error) {
+	var v1 payloadV1
+	if err := json.Unmarshal(payload, &v1); err != nil {
+		return EnergyData{}, err
+	}
+	data := EnergyData{
+		Version:      v1.Version,
+		ID:           v1.ID,
+		Date:         v1.Date,
+		TimezoneName: v1.TimezoneName,
+		Data:         make([]EnergyTuple, len(v1.Data)),
+		Signature:    v1.Signature,
+	}
+	for i, tuple := range v1.Data {
+		data.Data[i] = EnergyTuple{Value: tuple.Value, Timestamp: tuple.Timestamp}
+	}
+	return data, nil
+}
+
+// decodeV2 decodes version 2, which adds the unit of the values and the optional import and
+// export registers; it matches EnergyData one to one
+func decodeV2(payload []byte) (EnergyData, error) {
+	var data EnergyData
+	err := json.Unmarshal(payload, &data)
+	return data, err
+}
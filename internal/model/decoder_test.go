@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeEnergyData_V1(t *testing.T) {
+	payload := []byte(`{"version":1,"id":"abc","date":"2025-06-04","timezone_name":"Europe/Vienna",` +
+		`"data":[{"value":1.5,"timestamp":"2025-06-03 22:00:00"}]}`)
+
+	data, err := DecodeEnergyData(payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data.ID != "abc" || data.Date != "2025-06-04" || len(data.Data) != 1 || data.Data[0].Value != 1.5 {
+		t.Errorf("unexpected decoded data: %+v", data)
+	}
+}
+
+func TestDecodeEnergyData_V1IgnoresV2Members(t *testing.T) {
+	payload := []byte(`{"version":1,"id":"abc","date":"2025-06-04","timezone_name":"Europe/Vienna","unit":"Wh",` +
+		`"data":[{"value":1.5,"import":2,"export":1,"timestamp":"2025-06-03 22:00:00"}]}`)
+
+	data, err := DecodeEnergyData(payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data.Unit != "" || data.Data[0].Import != nil || data.Data[0].Export != nil || data.Data[0].Value != 1.5 {
+		t.Errorf("unexpected decoded data: %+v", data)
+	}
+}
+
+func TestDecodeEnergyData_V2(t *testing.T) {
+	payload := []byte(`{"version":2,"id":"abc","date":"2025-06-04","timezone_name":"Europe/Vienna","unit":"Wh",` +
+		`"data":[{"value":1500,"import":2000,"export":1000,"timestamp":"2025-06-03 22:00:00"}]}`)
+
+	data, err := DecodeEnergyData(payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tuple := data.Data[0]
+	if data.Unit != UnitWh || tuple.Value != 1500 || tuple.Import == nil || *tuple.Import != 2000 || tuple.Export == nil || *tuple.Export != 1000 {
+		t.Errorf("unexpected decoded data: %+v", data)
+	}
+}
+
+func TestDecodeEnergyData_UnsupportedVersion(t *testing.T) {
+	for _, payload := range []string{`{"version":99,"id":"abc"}`, `{"id":"abc"}`} {
+		_, err := DecodeEnergyData([]byte(payload))
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("DecodeEnergyData(%s) error = %v; want ErrUnsupportedVersion", payload, err)
+		}
+	}
+}
+
+func TestDecodeEnergyData_InvalidJSON(t *testing.T) {
+	_, err := DecodeEnergyData([]byte("not a json"))
+	if err == nil || errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected JSON error, got %v", err)
+	}
+}
@@ -1,14 +1,30 @@
 package model
 
+import "time"
+
 type DeviceStatus struct {
 	IsOn                bool     `json:"isOn"`
 	CurrentVoltage      float64  `json:"currentVoltage"`
 	CurrentAmps         float64  `json:"currentAmps"`
 	CurrentActivePower  float64  `json:"currentActivePower"`
 	TotalEnergyConsumed *float64 `json:"totalEnergyConsumed"`
+	Unit                string   `json:"unit,omitempty"` // unit of TotalEnergyConsumed, defaults to kWh
 }
 
 type DeviceStatusExt struct {
 	ID           string       `json:"id"`
 	DeviceStatus DeviceStatus `json:"deviceStatus"`
 }
+
+// CheckPlausibility checks the energy counter of a status received at ts against the limits of the
+// device type. previous is the last stored counter of the device in kWh, or nil if it has none.
+func (d DeviceStatus) CheckPlausibility(limits PlausibilityLimits, ts time.Time, previous *EnergyTuple) error {
+	if previous == nil || d.TotalEnergyConsumed == nil {
+		return nil
+	}
+	kwh, err := ToKWh(*d.TotalEnergyConsumed, d.Unit)
+	if err != nil {
+		return err
+	}
+	return CheckReadingStep(limits, *previous, EnergyTuple{Value: kwh, Timestamp: TimeStamp(ts)})
+}
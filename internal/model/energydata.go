@@ -7,6 +7,8 @@ import (
 
 type EnergyTuple struct {
 	Value     float64   `json:"value"`
+	Import    *float64  `json:"import,omitempty"` // optional cumulative register of energy drawn from the grid
+	Export    *float64  `json:"export,omitempty"` // optional cumulative register of energy fed into the grid
 	Timestamp TimeStamp `json:"timestamp"`
 }
 
@@ -33,19 +35,129 @@ func (t *TimeStamp) UnmarshalJSON(b []byte) error {
 }
 
 type EnergyData struct {
-	Version      int             `json:"version"`
-	ID           string          `json:"id"`
-	Date         string          `json:"date"`
-	TimezoneName string          `json:"timezone_name"`
-	Data         [96]EnergyTuple `json:"data"`
+	Version      int           `json:"version"`
+	ID           string        `json:"id"`
+	Date         string        `json:"date"`
+	TimezoneName string        `json:"timezone_name"`
+	Unit         string        `json:"unit,omitempty"` // Wh, kWh or MWh, defaults to kWh
+	Data         []EnergyTuple `json:"data"`
+	Signature    string        `json:"signature,omitempty"` // hex encoded device signature, the last member of the payload, see SplitSignature
 }
 
-// IsEnergyDataIncreasing checks if the Data array is monotonically non-decreasing by Value
-func IsEnergyDataIncreasing(data [96]EnergyTuple) bool {
+// IntervalLength is the duration covered by a single EnergyTuple
+const IntervalLength = 15 * time.Minute
+
+const dateLayout = "2006-01-02"
+
+// ExpectedIntervals returns the number of 15 minute intervals of the local day given by date and timezoneName.
+// This is 96 on regular days, 92 on the day daylight saving time starts and 100 on the day it ends.
+func ExpectedIntervals(date, timezoneName string) (int, error) {
+	start, end, err := LocalDay(date, timezoneName)
+	if err != nil {
+		return 0, err
+	}
+	return int(end.Sub(start) / IntervalLength), nil
+}
+
+// LocalDay returns the start and the end (midnight of the following day) of date in the IANA zone timezoneName
+func LocalDay(date, timezoneName string) (time.Time, time.Time, error) {
+	if timezoneName == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("missing timezone")
+	}
+	loc, err := time.LoadLocation(timezoneName)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid timezone %q: %v", timezoneName, err)
+	}
+	start, err := time.ParseInLocation(dateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q: %v", date, err)
+	}
+	end := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, loc)
+	return start, end, nil
+}
+
+// IntervalStarts returns the expected timestamps of a daily report for date in timezoneName.
+// Each timestamp marks the start of its interval, so the first one is local midnight of date.
+func IntervalStarts(date, timezoneName string) ([]time.Time, error) {
+	start, end, err := LocalDay(date, timezoneName)
+	if err != nil {
+		return nil, err
+	}
+	var starts []time.Time
+	for ts := start; ts.Before(end); ts = ts.Add(IntervalLength) {
+		starts = append(starts, ts.UTC())
+	}
+	return starts, nil
+}
+
+// ValidateIntervalCount checks that Data holds exactly one tuple per interval of the reported local day
+func (e EnergyData) ValidateIntervalCount() error {
+	expected, err := ExpectedIntervals(e.Date, e.TimezoneName)
+	if err != nil {
+		return err
+	}
+	if len(e.Data) != expected {
+		return fmt.Errorf("invalid number of intervals: got %d, expected %d for %s in %s", len(e.Data), expected, e.Date, e.TimezoneName)
+	}
+	return nil
+}
+
+// IsEnergyDataIncreasing checks if the Data slice is monotonically non-decreasing by Value
+// and by the Import and Export registers. A register that is reported has to be present in every tuple.
+func IsEnergyDataIncreasing(data []EnergyTuple) bool {
 	for i := 1; i < len(data); i++ {
 		if data[i].Value < data[i-1].Value {
 			return false
 		}
 	}
+	return isRegisterIncreasing(data, func(t EnergyTuple) *float64 { return t.Import }) &&
+		isRegisterIncreasing(data, func(t EnergyTuple) *float64 { return t.Export })
+}
+
+// IsEnergyDataIncreasingWithReset works like IsEnergyDataIncreasing but accepts a meter reset at resetAt.
+// The first tuple stamped at or after resetAt may drop below its predecessor, and from there on
+// no register may fall below its value in baseline. Registers without a baseline value are not compared.
+func IsEnergyDataIncreasingWithReset(data []EnergyTuple, resetAt time.Time, baseline EnergyTuple) bool {
+	idx := -1
+	for i := range data {
+		if !time.Time(data[i].Timestamp).Before(resetAt) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return IsEnergyDataIncreasing(data)
+	}
+	if !isAtLeast(data[idx], baseline) {
+		return false
+	}
+	return IsEnergyDataIncreasing(data[:idx]) && IsEnergyDataIncreasing(data[idx:])
+}
+
+// isAtLeast tells whether no register of t is below the same register of base
+func isAtLeast(t, base EnergyTuple) bool {
+	if t.Value < base.Value {
+		return false
+	}
+	if t.Import != nil && base.Import != nil && *t.Import < *base.Import {
+		return false
+	}
+	return t.Export == nil || base.Export == nil || *t.Export >= *base.Export
+}
+
+func isRegisterIncreasing(data []EnergyTuple, register func(EnergyTuple) *float64) bool {
+	if len(data) == 0 {
+		return true
+	}
+	reported := register(data[0]) != nil
+	for i := range data {
+		value := register(data[i])
+		if (value != nil) != reported {
+			return false
+		}
+		if i > 0 && reported && *value < *register(data[i-1]) {
+			return false
+		}
+	}
 	return true
 }
@@ -0,0 +1,160 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpectedIntervals(t *testing.T) {
+	tests := []struct {
+		date     string
+		timezone string
+		expected int
+	}{
+		{"2025-06-04", "Europe/Vienna", 96},
+		{"2025-03-30", "Europe/Vienna", 92},  // DST starts
+		{"2025-10-26", "Europe/Vienna", 100}, // DST starts
+		{"2025-03-30", "UTC", 96},
+	}
+
+	for _, test := range tests {
+		result, err := ExpectedIntervals(test.date, test.timezone)
+		if err != nil {
+			t.Fatalf("ExpectedIntervals(%q, %q) returned error: %v", test.date, test.timezone, err)
+		}
+		if result != test.expected {
+			t.Errorf("ExpectedIntervals(%q, %q) = %d; want %d", test.date, test.timezone, result, test.expected)
+		}
+	}
+}
+
+func TestExpectedIntervals_Invalid(t *testing.T) {
+	if _, err := ExpectedIntervals("2025-06-04", "Vienna/Europe"); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+	if _, err := ExpectedIntervals("04.06.2025", "Europe/Vienna"); err == nil {
+		t.Error("expected error for invalid date")
+	}
+}
+
+func TestValidateIntervalCount(t *testing.T) {
+	data := EnergyData{Date: "2025-10-26", TimezoneName: "Europe/Vienna", Data: make([]EnergyTuple, 100)}
+	if err := data.ValidateIntervalCount(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	data.Data = make([]EnergyTuple, 96)
+	if err := data.ValidateIntervalCount(); err == nil {
+		t.Error("expected error for 96 intervals on a 25 hour day")
+	}
+}
+
+func TestValidateTimestamps(t *testing.T) {
+	starts, err := IntervalStarts("2025-03-30", "Europe/Vienna")
+	if err != nil {
+		t.Fatalf("IntervalStarts returned error: %v", err)
+	}
+	if len(starts) != 92 {
+		t.Fatalf("Expected 92 timestamps, got %d", len(starts))
+	}
+	// the day starts at 23:00 UTC of the previous day, the last interval starts at 21:45 UTC
+	if got := starts[0].Format(timeLayout); got != "2025-03-29 23:00:00" {
+		t.Errorf("first timestamp = %s; want 2025-03-29 23:00:00", got)
+	}
+	if got := starts[91].Format(timeLayout); got != "2025-03-30 21:45:00" {
+		t.Errorf("last timestamp = %s; want 2025-03-30 21:45:00", got)
+	}
+
+	data := EnergyData{Date: "2025-03-30", TimezoneName: "Europe/Vienna", Data: make([]EnergyTuple, len(starts))}
+	for i, ts := range starts {
+		data.Data[i] = EnergyTuple{Value: float64(i), Timestamp: TimeStamp(ts)}
+	}
+	intervalErrors, err := data.ValidateTimestamps()
+	if err != nil || len(intervalErrors) != 0 {
+		t.Fatalf("unexpected errors: %v %v", err, intervalErrors)
+	}
+
+	// a report for last week is rejected in every interval
+	for i := range data.Data {
+		data.Data[i].Timestamp = TimeStamp(starts[i].AddDate(0, 0, -7))
+	}
+	intervalErrors, err = data.ValidateTimestamps()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(intervalErrors) != len(starts) {
+		t.Errorf("expected %d interval errors, got %d", len(starts), len(intervalErrors))
+	}
+
+	data.TimezoneName = "Mars/Olympus"
+	if _, err := data.ValidateTimestamps(); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
+
+func TestIsEnergyDataIncreasing_Registers(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+
+	data := []EnergyTuple{
+		{Value: 1, Import: f(1), Export: f(5)},
+		{Value: 2, Import: f(1), Export: f(6)},
+	}
+	if !IsEnergyDataIncreasing(data) {
+		t.Error("expected increasing registers to be valid")
+	}
+
+	data[1].Export = f(4)
+	if IsEnergyDataIncreasing(data) {
+		t.Error("expected decreasing export register to be invalid")
+	}
+
+	data[1].Export = nil
+	if IsEnergyDataIncreasing(data) {
+		t.Error("expected partially reported export register to be invalid")
+	}
+
+	data[0].Export = nil
+	if !IsEnergyDataIncreasing(data) {
+		t.Error("expected data without export register to be valid")
+	}
+}
+
+func TestIsEnergyDataIncreasingWithReset(t *testing.T) {
+	starts, err := IntervalStarts("2025-06-04", "Europe/Vienna")
+	if err != nil {
+		t.Fatalf("IntervalStarts returned error: %v", err)
+	}
+	data := make([]EnergyTuple, len(starts))
+	for i := range data {
+		data[i].Timestamp = TimeStamp(starts[i])
+		data[i].Value = 1000 + float64(i)
+		if i >= 40 {
+			// meter swapped, new counter starts at 5
+			data[i].Value = 5 + float64(i-40)
+		}
+	}
+	if IsEnergyDataIncreasing(data) {
+		t.Fatal("expected drop to be invalid without reset")
+	}
+	if !IsEnergyDataIncreasingWithReset(data, starts[40].Add(-time.Minute), EnergyTuple{Value: 5}) {
+		t.Error("expected drop at the reset interval to be valid")
+	}
+	if IsEnergyDataIncreasingWithReset(data, starts[40].Add(-time.Minute), EnergyTuple{Value: 10}) {
+		t.Error("expected values below the baseline to be invalid")
+	}
+	if IsEnergyDataIncreasingWithReset(data, starts[20], EnergyTuple{Value: 5}) {
+		t.Error("expected drop after the reset interval to be invalid")
+	}
+
+	for i := range data {
+		imported := data[i].Value + 100
+		data[i].Import = &imported
+	}
+	importBaseline := 105.0
+	if !IsEnergyDataIncreasingWithReset(data, starts[40].Add(-time.Minute), EnergyTuple{Value: 5, Import: &importBaseline}) {
+		t.Error("expected import at the baseline to be valid")
+	}
+	importBaseline = 110
+	if IsEnergyDataIncreasingWithReset(data, starts[40].Add(-time.Minute), EnergyTuple{Value: 5, Import: &importBaseline}) {
+		t.Error("expected import below the baseline to be invalid")
+	}
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PlausibilityLimits bounds the energy a device of a given type can plausibly report.
+// A zero limit is not enforced.
+type PlausibilityLimits struct {
+	MaxPowerKW        float64 // maximum average power over one interval
+	MaxDailyEnergyKWh float64 // maximum energy over the reported day
+	ExportAllowed     bool    // whether the device may feed energy into the grid
+}
+
+// CheckPlausibility checks a report against the limits of its device type. previous is the last
+// accepted reading of the device in kWh, or nil if it has none; the energy since then is checked
+// against the time that passed, and counts towards the daily total if the reading directly
+// precedes the report.
+func (e EnergyData) CheckPlausibility(limits PlausibilityLimits, previous *EnergyTuple) error {
+	normalized, err := e.Normalized()
+	if err != nil {
+		return err
+	}
+	data := normalized.Data
+	if len(data) == 0 {
+		return nil
+	}
+
+	first := data[0]
+	if previous != nil {
+		if err := CheckReadingStep(limits, *previous, data[0]); err != nil {
+			return fmt.Errorf("since the last reading: %v", err)
+		}
+		if stepDuration(*previous, data[0]) == IntervalLength {
+			first = *previous
+		}
+	}
+	for i := 1; i < len(data); i++ {
+		if err := CheckReadingStep(limits, data[i-1], data[i]); err != nil {
+			return fmt.Errorf("interval %d: %v", i, err)
+		}
+	}
+
+	if limits.MaxDailyEnergyKWh > 0 {
+		if total := data[len(data)-1].Value - first.Value; total > limits.MaxDailyEnergyKWh {
+			return fmt.Errorf("daily energy of %.3f kWh exceeds the maximum of %.3f kWh", total, limits.MaxDailyEnergyKWh)
+		}
+	}
+	return nil
+}
+
+// CheckReadingStep checks the energy between two cumulative readings in kWh against the power limit
+// over the time between them, and that the export register only grows if export is allowed
+func CheckReadingStep(limits PlausibilityLimits, previous, current EnergyTuple) error {
+	elapsed := stepDuration(previous, current)
+	if limits.MaxPowerKW > 0 {
+		maxDelta := limits.MaxPowerKW * elapsed.Hours()
+		if delta := current.Value - previous.Value; delta > maxDelta {
+			return fmt.Errorf("%.3f kWh exceeds the maximum of %.3f kWh in %s", delta, maxDelta, elapsed)
+		}
+		if current.Import != nil && previous.Import != nil {
+			if delta := *current.Import - *previous.Import; delta > maxDelta {
+				return fmt.Errorf("import of %.3f kWh exceeds the maximum of %.3f kWh in %s", delta, maxDelta, elapsed)
+			}
+		}
+		if current.Export != nil && previous.Export != nil {
+			if delta := *current.Export - *previous.Export; delta > maxDelta {
+				return fmt.Errorf("export of %.3f kWh exceeds the maximum of %.3f kWh in %s", delta, maxDelta, elapsed)
+			}
+		}
+	}
+	if !limits.ExportAllowed && current.Export != nil && previous.Export != nil && *current.Export > *previous.Export {
+		return errors.New("export is not allowed for this device type")
+	}
+	return nil
+}
+
+// stepDuration returns the time between two readings, at least one interval so that readings
+// without or with close timestamps are held to the limit of a single interval
+func stepDuration(previous, current EnergyTuple) time.Duration {
+	elapsed := time.Time(current.Timestamp).Sub(time.Time(previous.Timestamp))
+	if elapsed < IntervalLength {
+		return IntervalLength
+	}
+	return elapsed
+}
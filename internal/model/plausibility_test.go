@@ -0,0 +1,90 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckPlausibility(t *testing.T) {
+	plug := PlausibilityLimits{MaxPowerKW: 3.6, MaxDailyEnergyKWh: 50}
+
+	data := EnergyData{Data: make([]EnergyTuple, 96)}
+	for i := range data.Data {
+		data.Data[i].Value = float64(i) * 0.5 // 2 kW
+	}
+	if err := data.CheckPlausibility(plug, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	data.Data[10].Value += 1 // 6 kW in interval 10
+	if err := data.CheckPlausibility(plug, nil); err == nil {
+		t.Error("expected interval above max power to be rejected")
+	}
+
+	// 50 MWh in a day, reported in Wh
+	data = EnergyData{Unit: UnitMWh, Data: []EnergyTuple{{Value: 0}, {Value: 50}}}
+	if err := data.CheckPlausibility(PlausibilityLimits{MaxDailyEnergyKWh: 50}, nil); err == nil {
+		t.Error("expected daily energy above maximum to be rejected")
+	}
+
+	e1, e2 := 1.0, 2.0
+	data = EnergyData{Data: []EnergyTuple{{Value: 0, Export: &e1}, {Value: 0, Export: &e2}}}
+	if err := data.CheckPlausibility(plug, nil); err == nil {
+		t.Error("expected export to be rejected")
+	}
+	if err := data.CheckPlausibility(PlausibilityLimits{ExportAllowed: true}, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckPlausibility_PreviousReading(t *testing.T) {
+	plug := PlausibilityLimits{MaxPowerKW: 3.6, MaxDailyEnergyKWh: 50}
+	start := time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC)
+	data := EnergyData{Data: make([]EnergyTuple, 96)}
+	for i := range data.Data {
+		data.Data[i] = EnergyTuple{Value: 100 + float64(i)*0.5, Timestamp: TimeStamp(start.Add(time.Duration(i) * IntervalLength))}
+	}
+
+	// the last reading of the previous day is one interval before the report
+	previous := EnergyTuple{Value: 99.5, Timestamp: TimeStamp(start.Add(-IntervalLength))}
+	if err := data.CheckPlausibility(plug, &previous); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	previous.Value = 90
+	if err := data.CheckPlausibility(plug, &previous); err == nil {
+		t.Error("expected 10 kWh in the interval before the report to be rejected")
+	}
+
+	// the first interval counts towards the daily total: 47.5 kWh within the report plus 3 kWh before it
+	previous.Value = 97
+	plug.MaxPowerKW = 20
+	if err := data.CheckPlausibility(plug, &previous); err == nil {
+		t.Error("expected daily energy including the first interval to be rejected")
+	}
+
+	// a day after the last reading 10 kWh are plausible, but not part of the daily total
+	previous = EnergyTuple{Value: 90, Timestamp: TimeStamp(start.Add(-24 * time.Hour))}
+	plug.MaxPowerKW = 3.6
+	if err := data.CheckPlausibility(plug, &previous); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDeviceStatus_CheckPlausibility(t *testing.T) {
+	plug := PlausibilityLimits{MaxPowerKW: 3.6}
+	now := time.Date(2025, 6, 4, 12, 0, 0, 0, time.UTC)
+	previous := EnergyTuple{Value: 10, Timestamp: TimeStamp(now.Add(-time.Hour))}
+
+	total := 13000.0
+	status := DeviceStatus{TotalEnergyConsumed: &total, Unit: UnitWh}
+	if err := status.CheckPlausibility(plug, now, &previous); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	total = 14000
+	if err := status.CheckPlausibility(plug, now, &previous); err == nil {
+		t.Error("expected 4 kWh in an hour to be rejected")
+	}
+	if err := status.CheckPlausibility(plug, now, nil); err != nil {
+		t.Errorf("unexpected error without a previous status: %v", err)
+	}
+}
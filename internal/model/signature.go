@@ -0,0 +1,94 @@
+package model
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// PlanetmintAddressPrefix is the bech32 prefix of Planetmint account addresses
+const PlanetmintAddressPrefix = "plmnt"
+
+// ErrMissingSignature is returned when a report carries no signature
+var ErrMissingSignature = errors.New("report is not signed")
+
+// signatureMember matches the signature of a signed report, which has to be the last member of the JSON object
+var signatureMember = regexp.MustCompile(`,\s*"signature"\s*:\s*"([^"]*)"\s*}\s*$`)
+
+// SplitSignature separates a signed report payload into the bytes the device signed and the hex
+// encoded signature. A device serializes the report without a signature, signs exactly these bytes
+// and inserts ,"signature":"<hex>" as the last member before the closing brace; removing that member
+// again restores the signed bytes, whatever number formatting or whitespace the device used.
+func SplitSignature(payload []byte) (signed []byte, signatureHex string, err error) {
+	m := signatureMember.FindSubmatchIndex(payload)
+	if m == nil {
+		if bytes.Contains(payload, []byte(`"signature"`)) {
+			return nil, "", errors.New("signature has to be the last member of the report")
+		}
+		return nil, "", ErrMissingSignature
+	}
+	signed = append(append([]byte{}, payload[:m[0]]...), '}')
+	return signed, string(payload[m[2]:m[3]]), nil
+}
+
+// AppendSignature inserts the hex encoded signature as the last member of a serialized report
+func AppendSignature(payload []byte, signatureHex string) ([]byte, error) {
+	trimmed := bytes.TrimRight(payload, " \t\r\n")
+	if len(trimmed) < 2 || trimmed[len(trimmed)-1] != '}' {
+		return nil, errors.New("report is not a JSON object")
+	}
+	signed := append([]byte{}, trimmed[:len(trimmed)-1]...)
+	signed = append(signed, `,"signature":"`+signatureHex+`"}`...)
+	return signed, nil
+}
+
+// VerifyPayloadSignature checks the hex encoded secp256k1 signature (64 byte r||s over the SHA-256
+// of the bytes returned by SplitSignature) of a report payload against the hex encoded compressed
+// public key of the device
+func VerifyPayloadSignature(payload []byte, publicKeyHex string) error {
+	signed, signatureHex, err := SplitSignature(payload)
+	if err != nil {
+		return err
+	}
+	if signatureHex == "" {
+		return ErrMissingSignature
+	}
+	pubKey, err := ParsePublicKey(publicKeyHex)
+	if err != nil {
+		return err
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	if !pubKey.VerifySignature(signed, signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// ParsePublicKey decodes a hex encoded compressed secp256k1 public key
+func ParsePublicKey(publicKeyHex string) (*secp256k1.PubKey, error) {
+	key, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %v", err)
+	}
+	if len(key) != secp256k1.PubKeySize {
+		return nil, fmt.Errorf("invalid public key length: got %d, expected %d", len(key), secp256k1.PubKeySize)
+	}
+	return &secp256k1.PubKey{Key: key}, nil
+}
+
+// PlanetmintAddress derives the Planetmint account address of a hex encoded public key
+func PlanetmintAddress(publicKeyHex string) (string, error) {
+	pubKey, err := ParsePublicKey(publicKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return sdk.Bech32ifyAddressBytes(PlanetmintAddressPrefix, pubKey.Address())
+}
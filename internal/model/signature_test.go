@@ -0,0 +1,70 @@
+package model
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+)
+
+func TestVerifyPayloadSignature(t *testing.T) {
+	privKey := secp256k1.GenPrivKeyFromSecret([]byte("model-test"))
+	pubKeyHex := hex.EncodeToString(privKey.PubKey().Bytes())
+
+	// the device decides how to format its numbers, the exact bytes are signed
+	unsigned := []byte(`{"version":1,"id":"abc","date":"2025-06-04","data":[{"value":1.50},{"value":2e0}]}` + "\n")
+	if err := VerifyPayloadSignature(unsigned, pubKeyHex); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("expected ErrMissingSignature, got %v", err)
+	}
+
+	signature, err := privKey.Sign(bytes.TrimSpace(unsigned))
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	payload, err := AppendSignature(unsigned, hex.EncodeToString(signature))
+	if err != nil {
+		t.Fatalf("AppendSignature returned error: %v", err)
+	}
+	if err := VerifyPayloadSignature(payload, pubKeyHex); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	data, err := DecodeEnergyData(payload)
+	if err != nil {
+		t.Fatalf("signed payload does not decode: %v", err)
+	}
+	if data.Signature != hex.EncodeToString(signature) {
+		t.Errorf("unexpected signature %q", data.Signature)
+	}
+
+	otherKey := hex.EncodeToString(secp256k1.GenPrivKeyFromSecret([]byte("other")).PubKey().Bytes())
+	if err := VerifyPayloadSignature(payload, otherKey); err == nil {
+		t.Error("expected signature of another key to be rejected")
+	}
+
+	modified := bytes.Replace(payload, []byte("1.50"), []byte("1.5"), 1)
+	if err := VerifyPayloadSignature(modified, pubKeyHex); err == nil {
+		t.Error("expected modified report to be rejected")
+	}
+
+	moved := []byte(`{"signature":"` + hex.EncodeToString(signature) + `",` + string(unsigned[1:]))
+	if err := VerifyPayloadSignature(moved, pubKeyHex); err == nil || errors.Is(err, ErrMissingSignature) {
+		t.Errorf("expected signature that is not the last member to be rejected, got %v", err)
+	}
+}
+
+func TestPlanetmintAddress(t *testing.T) {
+	pubKeyHex := hex.EncodeToString(secp256k1.GenPrivKeyFromSecret([]byte("model-test")).PubKey().Bytes())
+	address, err := PlanetmintAddress(pubKeyHex)
+	if err != nil {
+		t.Fatalf("PlanetmintAddress returned error: %v", err)
+	}
+	if !strings.HasPrefix(address, PlanetmintAddressPrefix+"1") {
+		t.Errorf("unexpected address %s", address)
+	}
+	if _, err := PlanetmintAddress("abcd"); err == nil {
+		t.Error("expected error for short public key")
+	}
+}
@@ -0,0 +1,71 @@
+package model
+
+import "fmt"
+
+// Energy units accepted in payloads. Values are normalized to UnitKWh before they are stored.
+const (
+	UnitWh  = "Wh"
+	UnitKWh = "kWh"
+	UnitMWh = "MWh"
+)
+
+// DefaultUnit is assumed for payloads that do not state a unit
+const DefaultUnit = UnitKWh
+
+var unitFactors = map[string]float64{
+	UnitWh:  0.001,
+	UnitKWh: 1,
+	UnitMWh: 1000,
+}
+
+// IsValidUnit reports whether unit is a supported energy unit; an empty unit means DefaultUnit
+func IsValidUnit(unit string) bool {
+	if unit == "" {
+		return true
+	}
+	_, ok := unitFactors[unit]
+	return ok
+}
+
+// ToKWh converts an energy value given in unit to kWh
+func ToKWh(value float64, unit string) (float64, error) {
+	if unit == "" {
+		unit = DefaultUnit
+	}
+	factor, ok := unitFactors[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported unit %q", unit)
+	}
+	return value * factor, nil
+}
+
+// Normalized returns a copy of the report with all registers converted to kWh
+func (e EnergyData) Normalized() (EnergyData, error) {
+	if _, err := ToKWh(0, e.Unit); err != nil {
+		return e, err
+	}
+	normalized := e
+	normalized.Unit = UnitKWh
+	normalized.Data = make([]EnergyTuple, len(e.Data))
+	for i, tuple := range e.Data {
+		normalized.Data[i] = tuple.normalized(e.Unit)
+	}
+	return normalized, nil
+}
+
+func (t EnergyTuple) normalized(unit string) EnergyTuple {
+	convert := func(v float64) float64 {
+		kwh, _ := ToKWh(v, unit)
+		return kwh
+	}
+	t.Value = convert(t.Value)
+	if t.Import != nil {
+		v := convert(*t.Import)
+		t.Import = &v
+	}
+	if t.Export != nil {
+		v := convert(*t.Export)
+		t.Export = &v
+	}
+	return t
+}
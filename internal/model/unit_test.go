@@ -0,0 +1,44 @@
+package model
+
+import "testing"
+
+func TestToKWh(t *testing.T) {
+	tests := []struct {
+		value    float64
+		unit     string
+		expected float64
+	}{
+		{1500, UnitWh, 1.5},
+		{1.5, UnitKWh, 1.5},
+		{1.5, "", 1.5},
+		{0.002, UnitMWh, 2},
+	}
+	for _, test := range tests {
+		result, err := ToKWh(test.value, test.unit)
+		if err != nil {
+			t.Fatalf("ToKWh(%v, %q) returned error: %v", test.value, test.unit, err)
+		}
+		if result != test.expected {
+			t.Errorf("ToKWh(%v, %q) = %v; want %v", test.value, test.unit, result, test.expected)
+		}
+	}
+	if _, err := ToKWh(1, "kW/h"); err == nil {
+		t.Error("expected error for unsupported unit")
+	}
+}
+
+func TestNormalized(t *testing.T) {
+	export := 2000.0
+	data := EnergyData{Unit: UnitWh, Data: []EnergyTuple{{Value: 500, Export: &export}}}
+	normalized, err := data.Normalized()
+	if err != nil {
+		t.Fatalf("Normalized returned error: %v", err)
+	}
+	if normalized.Unit != UnitKWh || normalized.Data[0].Value != 0.5 || *normalized.Data[0].Export != 2 {
+		t.Errorf("unexpected normalized data: %+v", normalized.Data[0])
+	}
+	// the original report is left untouched
+	if data.Data[0].Value != 500 || *data.Data[0].Export != 2000 {
+		t.Error("Normalized modified the original report")
+	}
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// IntervalError describes why a single tuple of a report was rejected
+type IntervalError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// ValidateTimestamps checks that every tuple is exactly one interval after the previous one and that
+// the report covers the local day given by Date and TimezoneName. It returns one entry per offending
+// interval, or an error if the date or timezone cannot be resolved.
+func (e EnergyData) ValidateTimestamps() ([]IntervalError, error) {
+	expected, err := IntervalStarts(e.Date, e.TimezoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	var intervalErrors []IntervalError
+	for i, tuple := range e.Data {
+		ts := time.Time(tuple.Timestamp)
+		if i > 0 {
+			prev := time.Time(e.Data[i-1].Timestamp)
+			if diff := ts.Sub(prev); diff != IntervalLength {
+				intervalErrors = append(intervalErrors, IntervalError{
+					Index: i,
+					Error: fmt.Sprintf("timestamp %s is %v after the previous one, expected %v", ts.UTC().Format(timeLayout), diff, IntervalLength),
+				})
+				continue
+			}
+		}
+		if i >= len(expected) {
+			intervalErrors = append(intervalErrors, IntervalError{
+				Index: i,
+				Error: fmt.Sprintf("timestamp %s is outside of %s in %s", ts.UTC().Format(timeLayout), e.Date, e.TimezoneName),
+			})
+			continue
+		}
+		if !ts.Equal(expected[i]) {
+			intervalErrors = append(intervalErrors, IntervalError{
+				Index: i,
+				Error: fmt.Sprintf("timestamp %s does not match expected %s", ts.UTC().Format(timeLayout), expected[i].Format(timeLayout)),
+			})
+		}
+	}
+	if len(e.Data) < len(expected) {
+		intervalErrors = append(intervalErrors, IntervalError{
+			Index: len(e.Data),
+			Error: fmt.Sprintf("missing intervals: report ends before %s", expected[len(expected)-1].Format(timeLayout)),
+		})
+	}
+	return intervalErrors, nil
+}
@@ -0,0 +1,388 @@
+// Package outbox keeps InfluxDB writes on disk until they are delivered, so accepted reports
+// survive an InfluxDB outage and a restart of the service.
+package outbox
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+)
+
+// Kinds of queued items
+const (
+	KindReport       = "report"
+	KindDeviceStatus = "device_status"
+)
+
+// itemPrefix is followed by the big endian sequence number, so items are kept in the order they were queued
+const itemPrefix = "item/"
+
+// deadLetterPrefix is followed by the sequence number of an item that was given up after too many
+// failed deliveries. Dead letters are kept for inspection and are not delivered again.
+const deadLetterPrefix = "dead/"
+
+// Item is a batch of points waiting to be written to InfluxDB
+type Item struct {
+	Seq         uint64           `json:"-"`
+	Kind        string           `json:"kind"`                 // report or device_status
+	DeviceID    string           `json:"device_id"`            // Zigbee ID of the device the points belong to
+	Date        string           `json:"date,omitempty"`       // date of a report
+	Points      []influxdb.Point `json:"points"`               // field values are stored as JSON and read back as float64
+	EnqueuedAt  time.Time        `json:"enqueued_at"`          // time the item was queued
+	Attempts    int              `json:"attempts"`             // failed deliveries so far
+	NextAttempt time.Time        `json:"next_attempt"`         // the item is not delivered before this time
+	LastError   string           `json:"last_error,omitempty"` // error of the last failed delivery
+}
+
+// Stats describes the state of the queue
+type Stats struct {
+	Depth            int          `json:"depth"`                        // number of queued items
+	OldestEnqueuedAt *time.Time   `json:"oldest_enqueued_at,omitempty"` // time the oldest item was queued
+	OldestAgeSeconds float64      `json:"oldest_age_seconds"`           // age of the oldest item, 0 if the queue is empty
+	LastError        string       `json:"last_error,omitempty"`         // error of the last failed delivery, cleared by the next successful one
+	DeadLetters      []DeadLetter `json:"dead_letters,omitempty"`       // items that were given up, oldest first
+}
+
+// DeadLetter describes an item that was given up, without its points
+type DeadLetter struct {
+	Kind       string    `json:"kind"`
+	DeviceID   string    `json:"device_id"`
+	Date       string    `json:"date,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Outbox is a persistent FIFO queue of InfluxDB writes backed by LevelDB.
+// Every write is synced to disk, an item is durable once Enqueue returns.
+type Outbox struct {
+	db        *leveldb.DB
+	wo        *opt.WriteOptions
+	mu        sync.Mutex
+	seq       uint64
+	depth     int    // number of queued items, guarded by mu
+	lastError string // error of the last failed delivery, guarded by mu
+	notify    chan struct{}
+	retryMin  time.Duration
+	retryMax  time.Duration
+	attempts  int // deliveries of an item before it is given up
+}
+
+// Open opens or creates the queue at cfg.Path
+func Open(cfg config.OutboxConfig) (*Outbox, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("outbox path is not set")
+	}
+	db, err := leveldb.OpenFile(cfg.Path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox %s: %v", cfg.Path, err)
+	}
+	o := &Outbox{
+		db:       db,
+		wo:       &opt.WriteOptions{Sync: true},
+		notify:   make(chan struct{}, 1),
+		retryMin: time.Duration(cfg.RetryMinSeconds) * time.Second,
+		retryMax: time.Duration(cfg.RetryMaxSeconds) * time.Second,
+		attempts: cfg.MaxAttempts,
+	}
+	if o.retryMin <= 0 {
+		o.retryMin = 5 * time.Second
+	}
+	if o.retryMax < o.retryMin {
+		o.retryMax = o.retryMin
+	}
+	if o.attempts <= 0 {
+		o.attempts = 10
+	}
+
+	// count the queued items and continue the sequence after the newest one
+	iter := db.NewIterator(util.BytesPrefix([]byte(itemPrefix)), nil)
+	for iter.Next() {
+		o.depth++
+		o.seq = binary.BigEndian.Uint64(iter.Key()[len(itemPrefix):])
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// Close closes the queue, queued items are kept on disk
+func (o *Outbox) Close() error {
+	return o.db.Close()
+}
+
+func keyForSeq(seq uint64) []byte {
+	return keyWithSeq(itemPrefix, seq)
+}
+
+func keyForDeadLetter(seq uint64) []byte {
+	return keyWithSeq(deadLetterPrefix, seq)
+}
+
+func keyWithSeq(prefix string, seq uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], seq)
+	return key
+}
+
+// Enqueue appends an item to the queue and wakes up the worker
+func (o *Outbox) Enqueue(item Item) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	item.Seq = o.seq + 1
+	item.EnqueuedAt = time.Now().UTC()
+	if err := o.put(item); err != nil {
+		return err
+	}
+	o.seq = item.Seq
+	o.depth++
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (o *Outbox) put(item Item) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return o.db.Put(keyForSeq(item.Seq), value, o.wo)
+}
+
+func (o *Outbox) remove(seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.db.Delete(keyForSeq(seq), o.wo); err != nil {
+		return err
+	}
+	o.depth--
+	return nil
+}
+
+// giveUp moves an item from the queue to the dead letters
+func (o *Outbox) giveUp(item Item) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	batch.Delete(keyForSeq(item.Seq))
+	batch.Put(keyForDeadLetter(item.Seq), value)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.db.Write(batch, o.wo); err != nil {
+		return err
+	}
+	o.depth--
+	return nil
+}
+
+func decodeItem(key, value []byte) (Item, error) {
+	var item Item
+	if err := json.Unmarshal(value, &item); err != nil {
+		return item, fmt.Errorf("failed to decode outbox item %x: %v", key, err)
+	}
+	item.Seq = binary.BigEndian.Uint64(key[len(key)-8:])
+	return item, nil
+}
+
+// Each calls fn for the queued items in the order they were queued, decoding one item at a time.
+// It stops at the first error of fn and returns it.
+func (o *Outbox) Each(fn func(Item) error) error {
+	return o.each(itemPrefix, fn)
+}
+
+// EachDeadLetter calls fn for the items that were given up, like Each
+func (o *Outbox) EachDeadLetter(fn func(Item) error) error {
+	return o.each(deadLetterPrefix, fn)
+}
+
+func (o *Outbox) each(prefix string, fn func(Item) error) error {
+	iter := o.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		item, err := decodeItem(iter.Key(), iter.Value())
+		if err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// Items returns all queued items in the order they were queued, for inspection and tests
+func (o *Outbox) Items() ([]Item, error) {
+	var items []Item
+	err := o.Each(func(item Item) error {
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// Stats returns the depth of the queue, the age of its oldest item at now and the dead letters.
+// Of the queued items only the oldest one is read.
+func (o *Outbox) Stats(now time.Time) (Stats, error) {
+	o.mu.Lock()
+	stats := Stats{Depth: o.depth, LastError: o.lastError}
+	o.mu.Unlock()
+
+	iter := o.db.NewIterator(util.BytesPrefix([]byte(itemPrefix)), nil)
+	defer iter.Release()
+	if iter.First() {
+		item, err := decodeItem(iter.Key(), iter.Value())
+		if err != nil {
+			return Stats{}, err
+		}
+		oldest := item.EnqueuedAt
+		stats.OldestEnqueuedAt = &oldest
+		stats.OldestAgeSeconds = now.Sub(oldest).Seconds()
+	}
+	if err := iter.Error(); err != nil {
+		return Stats{}, err
+	}
+
+	err := o.EachDeadLetter(func(item Item) error {
+		stats.DeadLetters = append(stats.DeadLetters, DeadLetter{
+			Kind:       item.Kind,
+			DeviceID:   item.DeviceID,
+			Date:       item.Date,
+			EnqueuedAt: item.EnqueuedAt,
+			Attempts:   item.Attempts,
+			LastError:  item.LastError,
+		})
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	return stats, nil
+}
+
+func (o *Outbox) setLastError(lastError string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lastError = lastError
+}
+
+// retryDelay returns the delay after the given number of consecutive failures
+func (o *Outbox) retryDelay(failures int) time.Duration {
+	delay := o.retryMin
+	for i := 1; i < failures && delay < o.retryMax; i++ {
+		delay *= 2
+	}
+	if delay > o.retryMax {
+		delay = o.retryMax
+	}
+	return delay
+}
+
+// Run hands the queued items to deliver in order until stop is closed and removes every item
+// that was delivered. A failed item is retried with a doubling delay. After a failure the whole
+// queue backs off for a doubling delay, during which new items do not wake the worker, so an
+// unavailable InfluxDB is not flooded with requests; an item that keeps failing does not hold
+// back the items behind it. An item that failed MaxAttempts times is moved to the dead letters
+// and handed to dead, which may be nil.
+func (o *Outbox) Run(stop <-chan struct{}, deliver func(Item) error, dead func(Item)) {
+	failures := 0
+	for {
+		wait, err := o.flush(deliver, dead, &failures)
+		if err != nil {
+			log.Printf("Outbox: %v", err)
+			failures++
+			wait = o.retryDelay(failures)
+		}
+		timer := time.NewTimer(wait)
+		if failures > 0 {
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-o.notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// flush delivers the due items once and returns how long to wait before the next pass.
+// It stops at the first failure and returns the backoff of the queue.
+func (o *Outbox) flush(deliver func(Item) error, dead func(Item), failures *int) (time.Duration, error) {
+	wait := o.retryMax
+	now := time.Now()
+	var failed bool
+	err := o.Each(func(item Item) error {
+		if now.Before(item.NextAttempt) {
+			if until := item.NextAttempt.Sub(now); until < wait {
+				wait = until
+			}
+			return nil
+		}
+		if err := deliver(item); err != nil {
+			failed = true
+			*failures++
+			item.Attempts++
+			item.LastError = err.Error()
+			item.NextAttempt = time.Now().Add(o.retryDelay(item.Attempts))
+			log.Printf("Outbox: failed to deliver %s of %s (attempt %d): %v", item.Kind, item.DeviceID, item.Attempts, err)
+			o.setLastError(item.LastError)
+			if item.Attempts < o.attempts {
+				if err := o.put(item); err != nil {
+					return err
+				}
+				return errStopFlush
+			}
+			log.Printf("Outbox: giving up %s of %s after %d attempts", item.Kind, item.DeviceID, item.Attempts)
+			if err := o.giveUp(item); err != nil {
+				return err
+			}
+			if dead != nil {
+				dead(item)
+			}
+			return errStopFlush
+		}
+		*failures = 0
+		o.setLastError("")
+		return o.remove(item.Seq)
+	})
+	if err != nil && err != errStopFlush {
+		return 0, err
+	}
+	if failed {
+		return o.retryDelay(*failures), nil
+	}
+	return wait, nil
+}
+
+// errStopFlush ends a pass over the queue after a failed delivery
+var errStopFlush = errors.New("stop flush")
@@ -0,0 +1,242 @@
+package outbox
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+)
+
+func testPoint(value float64) influxdb.Point {
+	return influxdb.Point{
+		Measurement: "energy_data",
+		Tags:        map[string]string{"Inspelning": "zigbee1"},
+		Fields:      map[string]interface{}{"kW/h": value},
+		Timestamp:   time.Date(2025, 6, 4, 0, 15, 0, 0, time.UTC),
+	}
+}
+
+func TestOutbox_PersistsItemsInOrder(t *testing.T) {
+	cfg := config.OutboxConfig{Path: t.TempDir() + "/outbox.db"}
+	q, err := Open(cfg)
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee1", Date: "2025-06-04", Points: []influxdb.Point{testPoint(1)}}))
+	require.NoError(t, q.Enqueue(Item{Kind: KindDeviceStatus, DeviceID: "zigbee2", Points: []influxdb.Point{testPoint(2)}}))
+	require.NoError(t, q.Close())
+
+	// the items survive a restart and new items are queued behind them
+	q, err = Open(cfg)
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.Enqueue(Item{Kind: KindDeviceStatus, DeviceID: "zigbee3"}))
+
+	items, err := q.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+	assert.Equal(t, []string{"zigbee1", "zigbee2", "zigbee3"}, []string{items[0].DeviceID, items[1].DeviceID, items[2].DeviceID})
+	assert.Equal(t, []uint64{1, 2, 3}, []uint64{items[0].Seq, items[1].Seq, items[2].Seq})
+	assert.Equal(t, "2025-06-04", items[0].Date)
+	assert.Equal(t, testPoint(1).Fields, items[0].Points[0].Fields)
+	assert.True(t, testPoint(1).Timestamp.Equal(items[0].Points[0].Timestamp))
+}
+
+func TestOutbox_Stats(t *testing.T) {
+	q, err := Open(config.OutboxConfig{Path: t.TempDir() + "/outbox.db"})
+	require.NoError(t, err)
+	defer q.Close()
+
+	stats, err := q.Stats(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, Stats{}, stats)
+
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee1"}))
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee2"}))
+	items, err := q.Items()
+	require.NoError(t, err)
+
+	stats, err = q.Stats(items[0].EnqueuedAt.Add(90 * time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Depth)
+	require.NotNil(t, stats.OldestEnqueuedAt)
+	assert.True(t, items[0].EnqueuedAt.Equal(*stats.OldestEnqueuedAt))
+	assert.Equal(t, 90.0, stats.OldestAgeSeconds)
+}
+
+func TestOutbox_RetryDelay(t *testing.T) {
+	q := &Outbox{retryMin: 5 * time.Second, retryMax: 30 * time.Second}
+	assert.Equal(t, 5*time.Second, q.retryDelay(1))
+	assert.Equal(t, 10*time.Second, q.retryDelay(2))
+	assert.Equal(t, 20*time.Second, q.retryDelay(3))
+	assert.Equal(t, 30*time.Second, q.retryDelay(4))
+	assert.Equal(t, 30*time.Second, q.retryDelay(100))
+}
+
+func TestOutbox_FlushRetriesFailedItems(t *testing.T) {
+	q, err := Open(config.OutboxConfig{Path: t.TempDir() + "/outbox.db", RetryMinSeconds: 60, RetryMaxSeconds: 600})
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee1"}))
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee2"}))
+
+	// InfluxDB is down: the first item fails and the pass stops before the second one
+	var delivered []string
+	failures := 0
+	wait, err := q.flush(func(item Item) error {
+		delivered = append(delivered, item.DeviceID)
+		return errors.New("connection refused")
+	}, nil, &failures)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zigbee1"}, delivered)
+	assert.Equal(t, time.Minute, wait)
+
+	items, err := q.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, 1, items[0].Attempts)
+	assert.Equal(t, "connection refused", items[0].LastError)
+	assert.True(t, items[0].NextAttempt.After(time.Now()))
+	stats, err := q.Stats(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "connection refused", stats.LastError)
+
+	// InfluxDB is back: the item waiting for its retry does not hold back the next one
+	delivered = nil
+	wait, err = q.flush(func(item Item) error {
+		delivered = append(delivered, item.DeviceID)
+		return nil
+	}, nil, &failures)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zigbee2"}, delivered)
+	assert.Equal(t, 0, failures)
+	assert.LessOrEqual(t, wait, time.Minute)
+
+	items, err = q.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "zigbee1", items[0].DeviceID)
+}
+
+func TestOutbox_FlushGivesUpAfterMaxAttempts(t *testing.T) {
+	cfg := config.OutboxConfig{Path: t.TempDir() + "/outbox.db", RetryMinSeconds: 60, RetryMaxSeconds: 600, MaxAttempts: 2}
+	q, err := Open(cfg)
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee1", Date: "2025-06-04", Points: []influxdb.Point{testPoint(1)}}))
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee2"}))
+
+	failures := 0
+	var given []Item
+	failing := func(item Item) error { return errors.New("field type conflict") }
+	dead := func(item Item) { given = append(given, item) }
+	_, err = q.flush(failing, dead, &failures)
+	require.NoError(t, err)
+	assert.Empty(t, given)
+
+	// the second failed attempt moves the item to the dead letters
+	items, err := q.Items()
+	require.NoError(t, err)
+	items[0].NextAttempt = time.Time{}
+	require.NoError(t, q.put(items[0]))
+	_, err = q.flush(failing, dead, &failures)
+	require.NoError(t, err)
+	require.Len(t, given, 1)
+	assert.Equal(t, "zigbee1", given[0].DeviceID)
+	assert.Equal(t, 2, given[0].Attempts)
+
+	// the dead letter is kept across a restart but not delivered again
+	require.NoError(t, q.Close())
+	q, err = Open(cfg)
+	require.NoError(t, err)
+	defer q.Close()
+	items, err = q.Items()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "zigbee2", items[0].DeviceID)
+
+	stats, err := q.Stats(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Depth)
+	require.Len(t, stats.DeadLetters, 1)
+	assert.Equal(t, DeadLetter{
+		Kind:       KindReport,
+		DeviceID:   "zigbee1",
+		Date:       "2025-06-04",
+		EnqueuedAt: given[0].EnqueuedAt,
+		Attempts:   2,
+		LastError:  "field type conflict",
+	}, stats.DeadLetters[0])
+}
+
+func TestOutbox_RunDeliversQueuedItems(t *testing.T) {
+	q, err := Open(config.OutboxConfig{Path: t.TempDir() + "/outbox.db"})
+	require.NoError(t, err)
+	defer q.Close()
+
+	delivered := make(chan Item, 1)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(stop, func(item Item) error {
+			delivered <- item
+			return nil
+		}, nil)
+	}()
+
+	require.NoError(t, q.Enqueue(Item{Kind: KindDeviceStatus, DeviceID: "zigbee1", Points: []influxdb.Point{testPoint(3)}}))
+	select {
+	case item := <-delivered:
+		assert.Equal(t, "zigbee1", item.DeviceID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued item was not delivered")
+	}
+	close(stop)
+	<-done
+
+	items, err := q.Items()
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestOutbox_RunBacksOffAfterFailure(t *testing.T) {
+	q, err := Open(config.OutboxConfig{Path: t.TempDir() + "/outbox.db", RetryMinSeconds: 3600, RetryMaxSeconds: 3600})
+	require.NoError(t, err)
+	defer q.Close()
+
+	attempts := make(chan Item, 4)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(stop, func(item Item) error {
+			attempts <- item
+			return errors.New("connection refused")
+		}, nil)
+	}()
+
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee1", Points: []influxdb.Point{testPoint(1)}}))
+	select {
+	case <-attempts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued item was not delivered")
+	}
+
+	// a new item does not wake the worker while the queue backs off
+	require.NoError(t, q.Enqueue(Item{Kind: KindReport, DeviceID: "zigbee2", Points: []influxdb.Point{testPoint(2)}}))
+	select {
+	case item := <-attempts:
+		t.Fatalf("item of %s was delivered during the backoff", item.DeviceID)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(stop)
+	<-done
+
+	stats, err := q.Stats(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Depth)
+	assert.Equal(t, "connection refused", stats.LastError)
+}
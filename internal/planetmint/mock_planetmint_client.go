@@ -17,3 +17,9 @@ func (m *MockPlanetmintClient) RegisterDER(zigbeeID, planetmintAddress, liquidAd
 	args := m.Called(zigbeeID, planetmintAddress, liquidAddress, metadataJson)
 	return args.Error(0)
 }
+
+func (m *MockPlanetmintClient) GetDER(zigbeeID string) (*DER, error) {
+	args := m.Called(zigbeeID)
+	der, _ := args.Get(0).(*DER)
+	return der, args.Error(1)
+}
@@ -2,7 +2,9 @@ package planetmint
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"strings"
 
 	"github.com/cosmos/cosmos-sdk/codec"
 	ctypes "github.com/cosmos/cosmos-sdk/codec/types"
@@ -18,6 +20,33 @@ import (
 type IPlanetmintClient interface {
 	RegisterDER(id string, plmntAddress string, lidquidAddress string, metadatajson string) error
 	IsZigbeeRegistered(id string) (bool, error)
+	GetDER(id string) (*DER, error)
+}
+
+// DER is the registration record of a device on Planetmint
+type DER struct {
+	ZigbeeID          string
+	PlanetmintAddress string
+	LiquidAddress     string
+	MetadataJSON      string
+}
+
+// DERMetadata returns the metadata JSON registered with the DER of a device. The format, including
+// the brace in front of the name, is the one all registered DERs use and is kept as it is.
+func DERMetadata(deviceName string) string {
+	return "{ \"Device\": \"}" + deviceName + "\"}"
+}
+
+// DeviceName returns the device name from the metadata of the DER, empty if it has none
+func (d DER) DeviceName() string {
+	var metadata struct {
+		Device string `json:"Device"`
+	}
+	if err := json.Unmarshal([]byte(d.MetadataJSON), &metadata); err != nil {
+		return ""
+	}
+	// the metadata has a stray brace in front of the name, see DERMetadata
+	return strings.TrimPrefix(metadata.Device, "}")
 }
 
 type PlanetmintClient struct {
@@ -88,3 +117,24 @@ func (pmc *PlanetmintClient) IsZigbeeRegistered(id string) (registered bool, err
 	}
 	return
 }
+
+// GetDER returns the DER record of a Zigbee ID, or nil if the ID is not registered
+func (pmc *PlanetmintClient) GetDER(id string) (*DER, error) {
+	derClient := dertypes.NewQueryClient(pmc.conn)
+	res, err := derClient.Der(context.Background(), &dertypes.QueryDerRequest{ZigbeeID: id})
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if res == nil || res.Der == nil || res.Der.ZigbeeID != id {
+		return nil, nil
+	}
+	return &DER{
+		ZigbeeID:          res.Der.ZigbeeID,
+		PlanetmintAddress: res.Der.PlmntAddress,
+		LiquidAddress:     res.Der.LiquidAddress,
+		MetadataJSON:      res.Der.MetadataJson,
+	}, nil
+}
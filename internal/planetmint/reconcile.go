@@ -0,0 +1,137 @@
+package planetmint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/model"
+)
+
+// Kinds of mismatches between the local device registry and the DERs on Planetmint
+const (
+	MismatchMissingOnChain = "missing_on_chain" // the device is stored locally but has no DER
+	MismatchMissingLocally = "missing_locally"  // the DER exists but the device is not stored locally
+	MismatchAddresses      = "addresses"        // the addresses of the device differ from its DER
+)
+
+// ReconcileOptions controls what Reconcile checks and fixes
+type ReconcileOptions struct {
+	Fix        bool     // register missing DERs, store missing devices and take over the addresses of the DER
+	IDs        []string // Zigbee IDs to look up on Planetmint in addition to the local devices
+	DeviceType string   // device type of devices stored from a DER, such devices are only reported without it
+	ChangedBy  string   // recorded in the device history when addresses are fixed
+}
+
+// Mismatch is a difference between the local registry and Planetmint
+type Mismatch struct {
+	ZigbeeID string `json:"zigbee_id"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+	Fixed    bool   `json:"fixed"`
+	Error    string `json:"error,omitempty"` // why the mismatch could not be fixed
+}
+
+// Reconcile compares the local devices and the devices of opts.IDs with their DERs. Planetmint
+// can't be listed, so devices registered elsewhere are only found when their IDs are given.
+// The addresses of the DER win over the local ones, as the DER can't be changed.
+func Reconcile(db database.DeviceStore, client IPlanetmintClient, opts ReconcileOptions) ([]Mismatch, error) {
+	devices, err := db.GetAllDevices()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(devices)+len(opts.IDs))
+	for id := range devices {
+		ids = append(ids, id)
+	}
+	for _, id := range opts.IDs {
+		if _, local := devices[id]; !local {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var mismatches []Mismatch
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		der, err := client.GetDER(id)
+		if err != nil {
+			return mismatches, fmt.Errorf("failed to query the DER of %s: %v", id, err)
+		}
+		device, local := devices[id]
+		var mismatch Mismatch
+		switch {
+		case !local && der == nil:
+			continue
+		case !local:
+			mismatch = reconcileMissingLocally(db, *der, opts)
+		case der == nil:
+			mismatch = Mismatch{ZigbeeID: id, Kind: MismatchMissingOnChain, Detail: "device has no DER"}
+			if opts.Fix {
+				fixed(&mismatch, client.RegisterDER(id, device.PlanetmintAddress, device.LiquidAddress, DERMetadata(device.DeviceName)))
+			}
+		case device.LiquidAddress != der.LiquidAddress || device.PlanetmintAddress != der.PlanetmintAddress:
+			mismatch = Mismatch{
+				ZigbeeID: id,
+				Kind:     MismatchAddresses,
+				Detail: fmt.Sprintf("local liquid address %s and planetmint address %s, DER %s and %s",
+					device.LiquidAddress, device.PlanetmintAddress, der.LiquidAddress, der.PlanetmintAddress),
+			}
+			if opts.Fix {
+				if err := checkPublicKey(device.PublicKey, der.PlanetmintAddress); err != nil {
+					mismatch.Error = err.Error()
+					break
+				}
+				_, err := db.UpdateDevice(id, der.LiquidAddress, "", "", der.PlanetmintAddress, "", opts.ChangedBy)
+				fixed(&mismatch, err)
+			}
+		default:
+			continue
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	return mismatches, nil
+}
+
+func reconcileMissingLocally(db database.DeviceStore, der DER, opts ReconcileOptions) Mismatch {
+	mismatch := Mismatch{ZigbeeID: der.ZigbeeID, Kind: MismatchMissingLocally, Detail: "DER has no local device"}
+	if !opts.Fix {
+		return mismatch
+	}
+	if opts.DeviceType == "" {
+		mismatch.Error = "the device type of the device is unknown"
+		return mismatch
+	}
+	name := der.DeviceName()
+	if name == "" {
+		name = der.ZigbeeID
+	}
+	fixed(&mismatch, db.AddDevice(der.ZigbeeID, der.LiquidAddress, name, opts.DeviceType, der.PlanetmintAddress, ""))
+	return mismatch
+}
+
+// checkPublicKey checks that the public key of a device, if it has one, belongs to plmntAddress,
+// as it is checked when the device is registered
+func checkPublicKey(publicKey, plmntAddress string) error {
+	if publicKey == "" {
+		return nil
+	}
+	keyAddress, err := model.PlanetmintAddress(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	if keyAddress != plmntAddress {
+		return fmt.Errorf("the public key of the device does not match the planetmint address %s", plmntAddress)
+	}
+	return nil
+}
+
+func fixed(mismatch *Mismatch, err error) {
+	if err != nil {
+		mismatch.Error = err.Error()
+		return
+	}
+	mismatch.Fixed = true
+}
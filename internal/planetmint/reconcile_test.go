@@ -0,0 +1,94 @@
+package planetmint_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/planetmint"
+)
+
+func reconcileMocks() (*database.MockDatabase, *planetmint.MockPlanetmintClient) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetAllDevices").Return(map[string]database.Device{
+		"dev1": {LiquidAddress: "liq1", PlanetmintAddress: "plmnt1", DeviceName: "Plug 1"},
+		"dev2": {LiquidAddress: "liq2", PlanetmintAddress: "plmnt2", DeviceName: "Plug 2"},
+		"dev3": {LiquidAddress: "liq3", PlanetmintAddress: "plmnt3", DeviceName: "Plug 3"},
+	}, nil)
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	plmntMock.On("GetDER", "dev1").Return(&planetmint.DER{ZigbeeID: "dev1", LiquidAddress: "liq1", PlanetmintAddress: "plmnt1"}, nil)
+	plmntMock.On("GetDER", "dev2").Return(nil, nil)
+	plmntMock.On("GetDER", "dev3").Return(&planetmint.DER{ZigbeeID: "dev3", LiquidAddress: "liq3-chain", PlanetmintAddress: "plmnt3"}, nil)
+	plmntMock.On("GetDER", "dev4").Return(&planetmint.DER{
+		ZigbeeID: "dev4", LiquidAddress: "liq4", PlanetmintAddress: "plmnt4", MetadataJSON: `{ "Device": "}Plug 4"}`,
+	}, nil)
+	plmntMock.On("GetDER", "dev5").Return(nil, nil).Maybe()
+	return dbMock, plmntMock
+}
+
+func TestReconcile_Report(t *testing.T) {
+	dbMock, plmntMock := reconcileMocks()
+
+	mismatches, err := planetmint.Reconcile(dbMock, plmntMock, planetmint.ReconcileOptions{IDs: []string{"dev4", "dev5", "dev1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []planetmint.Mismatch{
+		{ZigbeeID: "dev2", Kind: planetmint.MismatchMissingOnChain, Detail: "device has no DER"},
+		{ZigbeeID: "dev3", Kind: planetmint.MismatchAddresses, Detail: "local liquid address liq3 and planetmint address plmnt3, DER liq3-chain and plmnt3"},
+		{ZigbeeID: "dev4", Kind: planetmint.MismatchMissingLocally, Detail: "DER has no local device"},
+	}, mismatches)
+	plmntMock.AssertNotCalled(t, "RegisterDER", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	dbMock.AssertNotCalled(t, "UpdateDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestReconcile_Fix(t *testing.T) {
+	dbMock, plmntMock := reconcileMocks()
+	plmntMock.On("RegisterDER", "dev2", "plmnt2", "liq2", `{ "Device": "}Plug 2"}`).Return(nil)
+	dbMock.On("UpdateDevice", "dev3", "liq3-chain", "", "", "plmnt3", "", "reconcile").Return(database.Device{}, nil)
+	dbMock.On("AddDevice", "dev4", "liq4", "Plug 4", "plug", "plmnt4", "").Return(nil)
+
+	mismatches, err := planetmint.Reconcile(dbMock, plmntMock, planetmint.ReconcileOptions{
+		Fix: true, IDs: []string{"dev4"}, DeviceType: "plug", ChangedBy: "reconcile",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 3)
+	for _, mismatch := range mismatches {
+		assert.True(t, mismatch.Fixed, mismatch.ZigbeeID)
+	}
+	plmntMock.AssertExpectations(t)
+	dbMock.AssertExpectations(t)
+}
+
+func TestReconcile_FixWithoutDeviceType(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetAllDevices").Return(map[string]database.Device{}, nil)
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	plmntMock.On("GetDER", "dev4").Return(&planetmint.DER{ZigbeeID: "dev4"}, nil)
+
+	mismatches, err := planetmint.Reconcile(dbMock, plmntMock, planetmint.ReconcileOptions{Fix: true, IDs: []string{"dev4"}})
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.False(t, mismatches[0].Fixed)
+	assert.NotEmpty(t, mismatches[0].Error)
+}
+
+func TestReconcile_FixKeepsAddressOfPublicKey(t *testing.T) {
+	publicKey := hex.EncodeToString(secp256k1.GenPrivKeyFromSecret([]byte("reconcile-test")).PubKey().Bytes())
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetAllDevices").Return(map[string]database.Device{
+		"dev1": {LiquidAddress: "liq1", PlanetmintAddress: "plmnt1", PublicKey: publicKey},
+	}, nil)
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	plmntMock.On("GetDER", "dev1").Return(&planetmint.DER{ZigbeeID: "dev1", LiquidAddress: "liq1", PlanetmintAddress: "plmnt1-chain"}, nil)
+
+	// the key of the device does not belong to the address of the DER, so the address is not taken over
+	mismatches, err := planetmint.Reconcile(dbMock, plmntMock, planetmint.ReconcileOptions{Fix: true})
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.False(t, mismatches[0].Fixed)
+	assert.Contains(t, mismatches[0].Error, "does not match the planetmint address plmnt1-chain")
+	dbMock.AssertNotCalled(t, "UpdateDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
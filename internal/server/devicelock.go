@@ -0,0 +1,41 @@
+package server
+
+import "sync"
+
+// deviceLocks serializes the ingestion of reports per device, so that duplicate checks
+// and last point comparisons of two reports of the same device cannot interleave
+type deviceLocks struct {
+	mutex sync.Mutex
+	locks map[string]*deviceLock
+}
+
+type deviceLock struct {
+	sync.Mutex
+	refs int // number of holders and waiters, the lock is dropped at zero
+}
+
+// lock blocks until the device is free and returns the function releasing it
+func (l *deviceLocks) lock(id string) func() {
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*deviceLock)
+	}
+	dl, ok := l.locks[id]
+	if !ok {
+		dl = &deviceLock{}
+		l.locks[id] = dl
+	}
+	dl.refs++
+	l.mutex.Unlock()
+
+	dl.Lock()
+	return func() {
+		dl.Unlock()
+		l.mutex.Lock()
+		dl.refs--
+		if dl.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mutex.Unlock()
+	}
+}
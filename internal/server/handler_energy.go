@@ -1,14 +1,17 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/model"
 )
 
@@ -19,10 +22,38 @@ func (s *Server) handleEnergyData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var energyData model.EnergyData
+	receivedAt := time.Now()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Failed to read request body"}, http.StatusBadRequest)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&energyData); err != nil {
-		sendJSONResponse(w, Response{Error: "Failed to decode JSON"}, http.StatusBadRequest)
+	energyData, err := model.DecodeEnergyData(body)
+	if err != nil {
+		if errors.Is(err, model.ErrUnsupportedVersion) {
+			sendJSONResponse(w, Response{Error: err.Error()}, http.StatusBadRequest)
+		} else {
+			sendJSONResponse(w, Response{Error: "Failed to decode JSON"}, http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := energyData.ValidateIntervalCount(); err != nil {
+		sendJSONResponse(w, Response{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	intervalErrors, err := energyData.ValidateTimestamps()
+	if err != nil {
+		sendJSONResponse(w, Response{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if len(intervalErrors) > 0 {
+		sendJSONResponse(w, Response{Error: "invalid timestamps", Intervals: intervalErrors}, http.StatusBadRequest)
+		return
+	}
+	if !model.IsValidUnit(energyData.Unit) {
+		sendJSONResponse(w, Response{Error: "unsupported unit " + energyData.Unit}, http.StatusBadRequest)
 		return
 	}
 
@@ -41,6 +72,32 @@ func (s *Server) handleEnergyData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	device, found, err := s.db.GetDevice(energyData.ID)
+	if err != nil {
+		log.Printf("Failed to get device: %v", err)
+		sendJSONResponse(w, Response{Error: "Database error"}, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		log.Printf("ID %s is not a registered device", energyData.ID)
+		sendJSONResponse(w, Response{Error: "Inspelning not registered"}, http.StatusBadRequest)
+		return
+	}
+	signatureResult, err := verifyReportSignature(body, device)
+	if err != nil {
+		log.Printf("Rejected report for ID %s: %v", energyData.ID, err)
+		sendJSONResponse(w, Response{Error: "Signature verification failed: " + err.Error()}, http.StatusUnauthorized)
+		return
+	}
+
+	limits, known := deviceTypeLimits(device.DeviceType)
+	if !known {
+		sendJSONResponse(w, Response{Error: "Unknown device type " + device.DeviceType}, http.StatusBadRequest)
+		return
+	}
+	unlock := s.ingestLocks.lock(energyData.ID)
+	defer unlock()
+
 	reportStatus, err := s.db.GetReportStatus(energyData.ID, energyData.Date)
 	if err != nil {
 		log.Printf("Failed to check report status: %v", err)
@@ -52,47 +109,73 @@ func (s *Server) handleEnergyData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// get first data element from payload
-	// compare it against the last registered datapoint of this reporting device
-	lastPoints, err := s.influxDBClient.GetLastPoint(context.Background(),
-		"energy_data",
-		map[string]string{
-			"Inspelning": energyData.ID,
-			"timezone":   energyData.TimezoneName,
-		})
+	reset, err := s.lastMeterReset(energyData)
 	if err != nil {
-		log.Printf("Failed to get last point from InfluxDB: %v", err)
-		sendJSONResponse(w, Response{Error: "Failed to retrieve last point from database"}, http.StatusInternalServerError)
+		log.Printf("Failed to get meter resets: %v", err)
+		sendJSONResponse(w, Response{Error: "Database error"}, http.StatusInternalServerError)
+		return
+	}
+
+	// compare the first data element of the payload against the last reading of this reporting device
+	last, err := s.lastReading(energyData)
+	if err != nil {
+		log.Printf("Failed to get last reading: %v", err)
+		sendJSONResponse(w, Response{Error: "Failed to retrieve last reading from database"}, http.StatusInternalServerError)
 		return
 	}
 	// check if data is equal or increased
-	if lastPoints != nil && energyData.Data[0].Value < lastPoints.Fields["kW/h"].(float64) {
+	if !isAboveLastReading(energyData, last, reset) {
 		sendJSONResponse(w, Response{Error: "Incompatible data: data does not increase."}, http.StatusConflict)
 		return
 	}
+	if err := energyData.CheckPlausibility(limits, plausibilityBase(energyData, last, reset)); err != nil {
+		log.Printf("Implausible report for ID %s: %v", energyData.ID, err)
+		sendJSONResponse(w, Response{Error: "Implausible data: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
 
-	status := "valid"
-	if !model.IsEnergyDataIncreasing(energyData.Data) {
-		status = "invalid"
+	record := newReportRecord(sourceHTTP, body, receivedAt)
+	record.Signature = signatureResult
+	if !isEnergyDataIncreasing(energyData, reset) {
+		record.Status = database.ReportStatusInvalid
+		record.Reason = "energy data is not increasing"
+		record.InfluxWrite = database.InfluxWriteSkipped
 		log.Printf("Energy data for ID %s is not increasing", energyData.ID)
 	}
+	var reading *database.LastReading
+	if record.Status == database.ReportStatusValid {
+		if reading, err = nextReading(last, energyData); err != nil {
+			sendJSONResponse(w, Response{Error: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
 
-	err = s.db.SetReportStatus(energyData.ID, energyData.Date, status)
+	claimed, err := s.db.ClaimReport(energyData.ID, energyData.Date, record, reading)
 	if err != nil {
-		log.Printf("Failed to store report status: %v", err)
+		log.Printf("Failed to store report record: %v", err)
+		sendJSONResponse(w, Response{Error: "Database error"}, http.StatusInternalServerError)
+		return
 	}
-	if status == "invalid" {
+	if !claimed {
+		sendJSONResponse(w, Response{Error: "report for this ID and date already exists"}, http.StatusConflict)
+		return
+	}
+	if record.Status == database.ReportStatusInvalid {
 		log.Printf("Energy data for ID %s is not compliant", energyData.ID)
 		sendJSONResponse(w, Response{Error: "data set is not compliant"}, http.StatusBadRequest)
 		return
 	}
 
-	go s.writeJSON2File(energyData)
-	err = s.write2InfluxDB(energyData)
+	s.runInBackground(func() { s.writeJSON2File(energyData) })
+	queued, err := s.storeReport(energyData, record, last)
 	if err != nil {
 		sendJSONResponse(w, Response{Error: "Failed to write to database"}, http.StatusInternalServerError)
 		return
 	}
+	if queued {
+		sendJSONResponse(w, Response{Message: "Energy data received and queued for writing to database"}, http.StatusOK)
+		return
+	}
 
 	sendJSONResponse(w, Response{Message: "Energy data received and written to database successfully"}, http.StatusOK)
 }
@@ -2,6 +2,7 @@ package server_test
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
 	"github.com/rddl-network/energy-service/internal/config"
 	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/influxdb"
@@ -19,10 +21,31 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
-func setupEnergyTestServer(t *testing.T, plmntMock *planetmint.MockPlanetmintClient, influxMock *influxdb.MockClient, dbMock *database.MockDatabase) (*server.Server, *http.ServeMux) {
-	_, err := config.LoadConfig("")
-	assert.NoError(t, err, "Failed to load configuration")
-	srv, err := server.NewServer(plmntMock, influxMock, dbMock)
+// testPassword is the admin password of the test configuration
+const testPassword = "testpwd"
+
+// useTestConfig replaces the configuration with the defaults and testPassword until the test ends,
+// so settings changed by one test don't leak into the next
+func useTestConfig(t *testing.T) *config.Config {
+	previous := *config.ConfigTestOnly
+	if previous == nil {
+		// the data file is written in the background and may still be read after the test
+		previous = config.DefaultConfig()
+		previous.Server.DataFile = os.DevNull
+	}
+	cfg := config.DefaultConfig()
+	cfg.Server.Password = testPassword
+	cfg.Server.DataFile = os.DevNull
+	*config.ConfigTestOnly = cfg
+	t.Cleanup(func() { *config.ConfigTestOnly = previous })
+	return cfg
+}
+
+// setupEnergyTestServer starts a server with the test configuration, the server is closed and the
+// configuration restored when the test ends
+func setupEnergyTestServer(t *testing.T, plmntClient planetmint.IPlanetmintClient, influxClient influxdb.Client, db database.DeviceStore) (*server.Server, *http.ServeMux) {
+	useTestConfig(t)
+	srv, err := server.NewServer(plmntClient, influxClient, db)
 	assert.NoError(t, err)
 	mux := http.NewServeMux()
 	srv.Routes(mux)
@@ -30,6 +53,45 @@ func setupEnergyTestServer(t *testing.T, plmntMock *planetmint.MockPlanetmintCli
 	return srv, mux
 }
 
+// intervalTimestamp returns the expected timestamp of interval i of a Europe/Vienna report for date
+func intervalTimestamp(t *testing.T, date string, i int) model.TimeStamp {
+	starts, err := model.IntervalStarts(date, "Europe/Vienna")
+	assert.NoError(t, err)
+	return model.TimeStamp(starts[i])
+}
+
+var testDeviceKey = secp256k1.GenPrivKeyFromSecret([]byte("energy-service-test-device"))
+
+// signReport signs a report with the test device key. Signature is the last field of EnergyData,
+// so marshalling the signed report appends it after the signed bytes.
+func signReport(t *testing.T, data *model.EnergyData) {
+	data.Signature = ""
+	msg, err := json.Marshal(data)
+	assert.NoError(t, err)
+	signature, err := testDeviceKey.Sign(msg)
+	assert.NoError(t, err)
+	data.Signature = hex.EncodeToString(signature)
+}
+
+// testDevicePublicKey returns the hex encoded public key of the test device
+func testDevicePublicKey() string {
+	return hex.EncodeToString(testDeviceKey.PubKey().Bytes())
+}
+
+// expectRegisteredDevice registers the test device key for id in the database mock, without meter resets
+func expectRegisteredDevice(dbMock *database.MockDatabase, id string) {
+	dbMock.On("GetDevice", id).Return(database.Device{PublicKey: testDevicePublicKey()}, true, nil)
+	dbMock.On("GetMeterResets", id).Return([]database.MeterReset(nil), nil)
+	// without a cached reading the last point in InfluxDB is used and cached
+	dbMock.On("GetLastReading", id).Return(database.LastReading{}, false, nil).Maybe()
+	dbMock.On("SetLastReading", id, mock.Anything).Return(nil).Maybe()
+}
+
+// reportWithStatus matches a stored report record by its status
+func reportWithStatus(status string) interface{} {
+	return mock.MatchedBy(func(record database.ReportRecord) bool { return record.Status == status })
+}
+
 func TestHandleEnergyData_InvalidJSON(t *testing.T) {
 	plmntMock := &planetmint.MockPlanetmintClient{}
 	influxMock := &influxdb.MockClient{}
@@ -51,22 +113,23 @@ func TestHandleEnergyData_UnregisteredZigbeeID(t *testing.T) {
 	dbMock := &database.MockDatabase{}
 	// Mock IsZigbeeRegistered to return false for any zigbeeID except "registered123"
 	plmntMock.On("IsZigbeeRegistered", mock.Anything).Return(false, nil)
-	dbMock.On("SetReportStatus", "unregistered123", "2025-06-04", "valid").Return(nil)
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	dbMock.On("ClaimReport", "unregistered123", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "unregistered123", "2025-06-04", reportWithStatus("valid")).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
 
-	var data [96]model.EnergyTuple
+	data := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		data[i] = model.EnergyTuple{
 			Value:     0,
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
 		}
 	}
 	energy := model.EnergyData{
 		Version:      1,
 		ID:           "unregistered123",
 		Date:         "2025-06-04",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         data,
 	}
 	body, _ := json.Marshal(energy)
@@ -84,8 +147,10 @@ func TestHandleEnergyData_Valid(t *testing.T) {
 	dbMock := &database.MockDatabase{}
 	// Mock IsZigbeeRegistered to return true for "registered123"
 	plmntMock.On("IsZigbeeRegistered", "registered123").Return(true, nil)
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	dbMock.On("SetReportStatus", "registered123", "2025-06-04", "valid").Return(nil)
+	expectRegisteredDevice(dbMock, "registered123")
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+	dbMock.On("ClaimReport", "registered123", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "registered123", "2025-06-04", reportWithStatus("valid")).Return(nil)
 	dbMock.On("GetReportStatus", "registered123", "2025-06-04").Return("", nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
 		Fields:    map[string]interface{}{"kW/h": 0.0},
@@ -96,11 +161,11 @@ func TestHandleEnergyData_Valid(t *testing.T) {
 	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
 
 	// Use a fully increasing array for valid test
-	var increasingData [96]model.EnergyTuple
+	increasingData := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		increasingData[i] = model.EnergyTuple{
 			Value:     float64(i),
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
 		}
 	}
 
@@ -108,9 +173,10 @@ func TestHandleEnergyData_Valid(t *testing.T) {
 		Version:      1,
 		ID:           "registered123",
 		Date:         "2025-06-04",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         increasingData,
 	}
+	signReport(t, &energy)
 	body, _ := json.Marshal(energy)
 	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -130,12 +196,9 @@ func TestDownloadEnergyData_EmptyFile(t *testing.T) {
 		t.Fatalf("failed to close temp file: %v", err)
 	}
 
-	cfg := config.GetConfig()
-	cfg.Server.DataFile = tempFile.Name()
-	cfg.Server.Password = "testpwd"
-
 	srv, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
 	defer srv.Close()
+	config.GetConfig().Server.DataFile = tempFile.Name()
 
 	req := httptest.NewRequest("GET", "/api/energy/download?pwd=testpwd", nil)
 	rr := httptest.NewRecorder()
@@ -153,12 +216,9 @@ func TestDownloadEnergyData_InvalidPassword(t *testing.T) {
 		t.Fatalf("failed to close temp file: %v", err)
 	}
 
-	cfg := config.GetConfig()
-	cfg.Server.DataFile = tempFile.Name()
-	cfg.Server.Password = "testpwd"
-
 	srv, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
 	defer srv.Close()
+	config.GetConfig().Server.DataFile = tempFile.Name()
 
 	req := httptest.NewRequest("GET", "/api/energy/download?pwd=wrongpwd", nil)
 	rr := httptest.NewRecorder()
@@ -172,7 +232,8 @@ func TestDownloadEnergyData_CrowdedFile(t *testing.T) {
 	assert.NoError(t, err)
 	defer func() { _ = os.Remove(tempFile.Name()) }()
 
-	var data1, data2 [96]model.EnergyTuple
+	data1 := make([]model.EnergyTuple, 96)
+	data2 := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		data1[i] = model.EnergyTuple{
 			Value:     1,
@@ -184,8 +245,8 @@ func TestDownloadEnergyData_CrowdedFile(t *testing.T) {
 		}
 	}
 	entries := []model.EnergyData{
-		{Version: 1, ID: "id1", Date: "2025-06-04", TimezoneName: "Vienna/Europe", Data: data1},
-		{Version: 1, ID: "id2", Date: "2025-06-05", TimezoneName: "Vienna/Europe", Data: data2},
+		{Version: 1, ID: "id1", Date: "2025-06-04", TimezoneName: "Europe/Vienna", Data: data1},
+		{Version: 1, ID: "id2", Date: "2025-06-05", TimezoneName: "Europe/Vienna", Data: data2},
 	}
 	enc := json.NewEncoder(tempFile)
 	for _, e := range entries {
@@ -195,12 +256,9 @@ func TestDownloadEnergyData_CrowdedFile(t *testing.T) {
 		t.Fatalf("failed to close temp file: %v", err)
 	}
 
-	cfg := config.GetConfig()
-	cfg.Server.DataFile = tempFile.Name()
-	cfg.Server.Password = "testpwd"
-
 	srv, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
 	defer srv.Close()
+	config.GetConfig().Server.DataFile = tempFile.Name()
 
 	req := httptest.NewRequest("GET", "/api/energy/download?pwd=testpwd", nil)
 	rr := httptest.NewRecorder()
@@ -223,12 +281,9 @@ func TestDownloadEnergyData_CorruptedFile(t *testing.T) {
 		t.Fatalf("failed to close temp file: %v", err)
 	}
 
-	cfg := config.GetConfig()
-	cfg.Server.DataFile = tempFile.Name()
-	cfg.Server.Password = "testpwd"
-
 	srv, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
 	defer srv.Close()
+	config.GetConfig().Server.DataFile = tempFile.Name()
 
 	req := httptest.NewRequest("GET", "/api/energy/download?pwd=testpwd", nil)
 	rr := httptest.NewRecorder()
@@ -242,9 +297,11 @@ func TestHandleEnergyData_IncrementalVsLastPoint(t *testing.T) {
 	influxMock := &influxdb.MockClient{}
 	dbMock := &database.MockDatabase{}
 	plmntMock.On("IsZigbeeRegistered", "zigbeeInc").Return(true, nil)
-	dbMock.On("SetReportStatus", "zigbeeInc", "2025-06-04", "valid").Return(nil)
+	expectRegisteredDevice(dbMock, "zigbeeInc")
+	dbMock.On("ClaimReport", "zigbeeInc", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeInc", "2025-06-04", reportWithStatus("valid")).Return(nil)
 	dbMock.On("GetReportStatus", "zigbeeInc", "2025-06-04").Return("", nil)
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
 		Fields:    map[string]interface{}{"kW/h": 10.0},
 		Tags:      map[string]string{"id": "zigbeeInc"},
@@ -252,20 +309,21 @@ func TestHandleEnergyData_IncrementalVsLastPoint(t *testing.T) {
 	}, nil)
 
 	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
-	var data [96]model.EnergyTuple
+	data := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		data[i] = model.EnergyTuple{
 			Value:     10.0 + float64(i+1), // strictly increasing
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
 		}
 	}
 	energy := model.EnergyData{
 		Version:      1,
 		ID:           "zigbeeInc",
 		Date:         "2025-06-04",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         data,
 	}
+	signReport(t, &energy)
 	body, _ := json.Marshal(energy)
 	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -280,9 +338,11 @@ func TestHandleEnergyData_EqualVsLastPoint(t *testing.T) {
 	influxMock := &influxdb.MockClient{}
 	dbMock := &database.MockDatabase{}
 	plmntMock.On("IsZigbeeRegistered", "zigbeeEq").Return(true, nil)
-	dbMock.On("SetReportStatus", "zigbeeEq", "2025-06-04", "valid").Return(nil)
+	expectRegisteredDevice(dbMock, "zigbeeEq")
+	dbMock.On("ClaimReport", "zigbeeEq", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeEq", "2025-06-04", reportWithStatus("valid")).Return(nil)
 	dbMock.On("GetReportStatus", "zigbeeEq", "2025-06-04").Return("", nil)
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
 		Fields:    map[string]interface{}{"kW/h": 10.0},
 		Tags:      map[string]string{"id": "zigbeeEq"},
@@ -290,20 +350,21 @@ func TestHandleEnergyData_EqualVsLastPoint(t *testing.T) {
 	}, nil)
 
 	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
-	var data [96]model.EnergyTuple
+	data := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		data[i] = model.EnergyTuple{
 			Value:     10.0, // equal to last point
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
 		}
 	}
 	energy := model.EnergyData{
 		Version:      1,
 		ID:           "zigbeeEq",
 		Date:         "2025-06-04",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         data,
 	}
+	signReport(t, &energy)
 	body, _ := json.Marshal(energy)
 	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -319,26 +380,29 @@ func TestHandleEnergyData_EqualVsLastPoint_no_previous_data(t *testing.T) {
 	influxMock := &influxdb.MockClient{}
 	dbMock := &database.MockDatabase{}
 	plmntMock.On("IsZigbeeRegistered", "zigbeeEq").Return(true, nil)
-	dbMock.On("SetReportStatus", "zigbeeEq", "2025-06-04", "valid").Return(nil)
+	expectRegisteredDevice(dbMock, "zigbeeEq")
+	dbMock.On("ClaimReport", "zigbeeEq", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeEq", "2025-06-04", reportWithStatus("valid")).Return(nil)
 	dbMock.On("GetReportStatus", "zigbeeEq", "2025-06-04").Return("", nil)
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
 
 	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
-	var data [96]model.EnergyTuple
+	data := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		data[i] = model.EnergyTuple{
 			Value:     10.0, // equal to last point
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
 		}
 	}
 	energy := model.EnergyData{
 		Version:      1,
 		ID:           "zigbeeEq",
 		Date:         "2025-06-04",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         data,
 	}
+	signReport(t, &energy)
 	body, _ := json.Marshal(energy)
 	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -354,9 +418,11 @@ func TestHandleEnergyData_LowerVsLastPoint(t *testing.T) {
 	influxMock := &influxdb.MockClient{}
 	dbMock := &database.MockDatabase{}
 	plmntMock.On("IsZigbeeRegistered", "zigbeeLow").Return(true, nil)
-	dbMock.On("SetReportStatus", "zigbeeLow", "2025-06-04", "valid").Return(nil)
+	expectRegisteredDevice(dbMock, "zigbeeLow")
+	dbMock.On("ClaimReport", "zigbeeLow", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeLow", "2025-06-04", reportWithStatus("valid")).Return(nil)
 	dbMock.On("GetReportStatus", "zigbeeLow", "2025-06-04").Return("", nil)
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
 		Fields:    map[string]interface{}{"kW/h": 10.0},
 		Tags:      map[string]string{"id": "zigbeeLow"},
@@ -364,25 +430,489 @@ func TestHandleEnergyData_LowerVsLastPoint(t *testing.T) {
 	}, nil)
 
 	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
-	var data [96]model.EnergyTuple
+	data := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		data[i] = model.EnergyTuple{
 			Value:     9.0, // lower than last point
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
 		}
 	}
 	energy := model.EnergyData{
 		Version:      1,
 		ID:           "zigbeeLow",
 		Date:         "2025-06-04",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
+		Data:         data,
+	}
+	signReport(t, &energy)
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.NotEqual(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Incompatible data: data does not increase")
+}
+
+// postDailyReport uploads a signed report of 96 intervals with the given values
+func postDailyReport(t *testing.T, mux http.Handler, id string, date string, value func(i int) float64) *httptest.ResponseRecorder {
+	t.Helper()
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{
+			Value:     value(i),
+			Timestamp: intervalTimestamp(t, date, i),
+		}
+	}
+	energy := model.EnergyData{
+		Version:      1,
+		ID:           id,
+		Date:         date,
+		TimezoneName: "Europe/Vienna",
 		Data:         data,
 	}
+	signReport(t, &energy)
 	body, _ := json.Marshal(energy)
 	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleEnergyData_LowerVsCachedReading(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeCached").Return(true, nil)
+	dbMock.On("GetLastReading", "zigbeeCached").Return(database.LastReading{
+		Timestamp: time.Now().UTC(),
+		EnergyKWh: 10.0,
+	}, true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeCached")
+	dbMock.On("GetReportStatus", "zigbeeCached", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeCached", "2025-06-04", mock.Anything, mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeCached", "2025-06-04", mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	rr := postDailyReport(t, mux, "zigbeeCached", "2025-06-04", func(int) float64 { return 9.0 })
 	assert.NotEqual(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Incompatible data: data does not increase")
+	// the cached reading makes a lookup in InfluxDB unnecessary
+	influxMock.AssertNotCalled(t, "GetLastPoint", mock.Anything, mock.Anything, mock.Anything)
+	dbMock.AssertNotCalled(t, "SetLastReading", mock.Anything, mock.Anything)
+}
+
+func TestHandleEnergyData_UpdatesLastReading(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	importKWh := 3.0
+	plmntMock.On("IsZigbeeRegistered", "zigbeeReading").Return(true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeReading")
+	dbMock.On("GetReportStatus", "zigbeeReading", "2025-06-04").Return("", nil)
+	dbMock.On("SetReportRecord", "zigbeeReading", "2025-06-04", mock.Anything).Return(nil)
+	dbMock.On("ClaimReport", "zigbeeReading", "2025-06-04", reportWithStatus("valid"),
+		mock.MatchedBy(func(reading *database.LastReading) bool {
+			// the reading of the last interval replaces the cached one, the import
+			// register the report does not carry is taken over from InfluxDB
+			return reading != nil && reading.EnergyKWh == 115.0 &&
+				reading.Timestamp.Equal(time.Time(intervalTimestamp(t, "2025-06-04", 95))) &&
+				reading.ImportKWh != nil && *reading.ImportKWh == importKWh
+		})).Return(true, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("GetLastPoint", mock.Anything, "energy_data", mock.Anything).Return(&influxdb.LastPointResult{
+		Fields:    map[string]interface{}{"kW/h": 10.0, "import_energy_kwh": importKWh},
+		Timestamp: time.Date(2025, 6, 3, 21, 45, 0, 0, time.UTC),
+	}, nil)
+
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	rr := postDailyReport(t, mux, "zigbeeReading", "2025-06-04", func(i int) float64 { return float64(20 + i) })
+	assert.Equal(t, http.StatusOK, rr.Code)
+	dbMock.AssertCalled(t, "SetLastReading", "zigbeeReading", database.LastReading{
+		Timestamp: time.Date(2025, 6, 3, 21, 45, 0, 0, time.UTC),
+		EnergyKWh: 10.0,
+		ImportKWh: &importKWh,
+	})
+	dbMock.AssertExpectations(t)
+}
+
+func TestHandleEnergyData_WrongIntervalCount(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	// 2025-03-30 is the start of daylight saving time in Vienna and only has 92 intervals
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{
+			Value:     float64(i),
+			Timestamp: model.TimeStamp(time.Now().UTC()),
+		}
+	}
+	energy := model.EnergyData{
+		Version:      1,
+		ID:           "zigbeeDST",
+		Date:         "2025-03-30",
+		TimezoneName: "Europe/Vienna",
+		Data:         data,
+	}
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid number of intervals: got 96, expected 92")
+}
+
+func TestHandleEnergyData_InvalidTimestamps(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{
+			Value:     float64(i),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
+		}
+	}
+	// repeat a slot
+	data[10].Timestamp = data[9].Timestamp
+	energy := model.EnergyData{
+		Version:      1,
+		ID:           "zigbeeTS",
+		Date:         "2025-06-04",
+		TimezoneName: "Europe/Vienna",
+		Data:         data,
+	}
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var resp server.Response
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, "invalid timestamps", resp.Error)
+	if assert.Len(t, resp.Intervals, 2) {
+		assert.Equal(t, 10, resp.Intervals[0].Index)
+		assert.Equal(t, 11, resp.Intervals[1].Index)
+	}
+}
+
+func TestHandleEnergyData_UnsupportedVersion(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	body := []byte(`{"version":42,"id":"zigbeeV42","date":"2025-06-04","timezone_name":"Europe/Vienna","data":[]}`)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unsupported payload version: 42")
+}
+
+func bidirectionalReport(t *testing.T, id string) model.EnergyData {
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		imp := 100.0 + float64(i)
+		exp := 50.0 + float64(i)/2
+		data[i] = model.EnergyTuple{
+			Value:     float64(i),
+			Import:    &imp,
+			Export:    &exp,
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
+		}
+	}
+	return model.EnergyData{
+		Version:      2,
+		ID:           id,
+		Date:         "2025-06-04",
+		TimezoneName: "Europe/Vienna",
+		Data:         data,
+	}
+}
+
+func TestHandleEnergyData_Bidirectional(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeBidi").Return(true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeBidi")
+	dbMock.On("ClaimReport", "zigbeeBidi", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeBidi", "2025-06-04", reportWithStatus("valid")).Return(nil)
+	dbMock.On("GetReportStatus", "zigbeeBidi", "2025-06-04").Return("", nil)
+	influxMock.On("WritePoints", mock.Anything, mock.MatchedBy(func(points []influxdb.Point) bool {
+		for _, point := range points {
+			_, hasImport := point.Fields["import_kW/h"]
+			_, hasExport := point.Fields["export_kW/h"]
+			if point.Measurement != "energy_data" || !hasImport || !hasExport {
+				return false
+			}
+		}
+		return len(points) == 96
+	})).Return(nil)
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
+		Fields:    map[string]interface{}{"kW/h": 0.0, "import_kW/h": 100.0, "export_kW/h": 50.0},
+		Timestamp: time.Now().UTC(),
+	}, nil)
+
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	report := bidirectionalReport(t, "zigbeeBidi")
+	signReport(t, &report)
+	body, _ := json.Marshal(report)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	influxMock.AssertNumberOfCalls(t, "WritePoints", 1)
+}
+
+func TestHandleEnergyData_ExportLowerVsLastPoint(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeExp").Return(true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeExp")
+	dbMock.On("GetReportStatus", "zigbeeExp", "2025-06-04").Return("", nil)
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
+		Fields:    map[string]interface{}{"kW/h": 0.0, "import_kW/h": 100.0, "export_kW/h": 60.0},
+		Timestamp: time.Now().UTC(),
+	}, nil)
+
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	report := bidirectionalReport(t, "zigbeeExp")
+	signReport(t, &report)
+	body, _ := json.Marshal(report)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Incompatible data: data does not increase")
+}
+
+// A device with a registered key has to sign its reports, even if unsigned reports are accepted
+func TestHandleEnergyData_Unsigned(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeUnsigned").Return(true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeUnsigned")
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	body, _ := json.Marshal(bidirectionalReport(t, "zigbeeUnsigned"))
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "report is not signed")
+	dbMock.AssertNotCalled(t, "ClaimReport", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleEnergyData_UnknownDevice(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	// the DER remains on Planetmint after the device was deregistered
+	plmntMock.On("IsZigbeeRegistered", "zigbeeGone").Return(true, nil)
+	dbMock.On("GetDevice", "zigbeeGone").Return(database.Device{}, false, nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	body, _ := json.Marshal(bidirectionalReport(t, "zigbeeGone"))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Inspelning not registered")
+	dbMock.AssertNotCalled(t, "ClaimReport", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleEnergyData_DeviceWithoutKey(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeNoKey").Return(true, nil)
+	dbMock.On("GetDevice", "zigbeeNoKey").Return(database.Device{DeviceType: "plug"}, true, nil)
+	dbMock.On("GetMeterResets", "zigbeeNoKey").Return([]database.MeterReset(nil), nil)
+	dbMock.On("GetLastReading", "zigbeeNoKey").Return(database.LastReading{}, false, nil)
+	dbMock.On("SetLastReading", "zigbeeNoKey", mock.Anything).Return(nil)
+	dbMock.On("GetReportStatus", "zigbeeNoKey", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeNoKey", "2025-06-04", mock.MatchedBy(func(record database.ReportRecord) bool {
+		return record.Status == database.ReportStatusValid && record.Signature == "unsigned"
+	}), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeNoKey", "2025-06-04", reportWithStatus("valid")).Return(nil)
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	body, _ := json.Marshal(bidirectionalReport(t, "zigbeeNoKey"))
+
+	// reports of devices without a key are rejected by default
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "no public key registered")
+	dbMock.AssertNotCalled(t, "ClaimReport", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// and accepted as unsigned once unsigned reports are allowed
+	config.GetConfig().Server.RequireSignedReports = false
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	dbMock.AssertCalled(t, "ClaimReport", "zigbeeNoKey", "2025-06-04", mock.Anything, mock.Anything)
+}
+
+func TestHandleEnergyData_TamperedSignature(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeTampered").Return(true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeTampered")
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	report := bidirectionalReport(t, "zigbeeTampered")
+	signReport(t, &report)
+	report.Data[95].Value = 1000
+	body, _ := json.Marshal(report)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid signature")
+}
+
+func TestHandleEnergyData_UnitNormalization(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeWh").Return(true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeWh")
+	dbMock.On("GetReportStatus", "zigbeeWh", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeWh", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeWh", "2025-06-04", reportWithStatus("valid")).Return(nil)
+	// last stored point is 10 kWh, the report starts at 10500 Wh
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
+		Fields:    map[string]interface{}{"kW/h": 10.0, "energy_kwh": 10.0},
+		Timestamp: time.Now().UTC(),
+	}, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	config.GetConfig().InfluxDB.FieldSchema = config.FieldSchemaDual
+
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{
+			Value:     10500 + float64(i)*100,
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
+		}
+	}
+	energy := model.EnergyData{
+		Version:      2,
+		ID:           "zigbeeWh",
+		Date:         "2025-06-04",
+		TimezoneName: "Europe/Vienna",
+		Unit:         model.UnitWh,
+		Data:         data,
+	}
+	signReport(t, &energy)
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	points := influxMock.Calls[len(influxMock.Calls)-1].Arguments.Get(1).([]influxdb.Point)
+	fields := points[0].Fields
+	assert.Equal(t, 10.5, fields["kW/h"])
+	assert.Equal(t, 10.5, fields["energy_kwh"])
+}
+
+func TestHandleEnergyData_UnsupportedUnit(t *testing.T) {
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
+
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{Value: float64(i), Timestamp: intervalTimestamp(t, "2025-06-04", i)}
+	}
+	energy := model.EnergyData{
+		Version:      2,
+		ID:           "zigbeeUnit",
+		Date:         "2025-06-04",
+		TimezoneName: "Europe/Vienna",
+		Unit:         "kW/h",
+		Data:         data,
+	}
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unsupported unit")
+}
+
+// withDeviceTypes installs a device type catalog for the duration of a test
+func withDeviceTypes(t *testing.T, catalog map[string]config.DeviceTypeConfig) {
+	cfg := config.GetConfig()
+	previous := cfg.DeviceTypes
+	cfg.DeviceTypes = catalog
+	t.Cleanup(func() { cfg.DeviceTypes = previous })
+}
+
+func TestHandleEnergyData_ImplausibleForDeviceType(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeePlug").Return(true, nil)
+	dbMock.On("GetDevice", "zigbeePlug").Return(database.Device{DeviceType: "plug", PublicKey: testDevicePublicKey()}, true, nil)
+	dbMock.On("GetReportStatus", "zigbeePlug", mock.Anything).Return("", nil)
+	dbMock.On("GetMeterResets", "zigbeePlug").Return([]database.MeterReset(nil), nil)
+	// the last reading directly precedes 2025-06-05 and is 10 kWh below its first interval
+	dbMock.On("GetLastReading", "zigbeePlug").Return(database.LastReading{
+		Timestamp: time.Time(intervalTimestamp(t, "2025-06-04", 95)),
+		EnergyKWh: 90,
+	}, true, nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+	withDeviceTypes(t, map[string]config.DeviceTypeConfig{"plug": {MaxPowerKW: 3.6, MaxDailyEnergyKWh: 50}})
+
+	// 1 MWh per interval
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{Value: 90 + float64(i)*1000, Timestamp: intervalTimestamp(t, "2025-06-04", i)}
+	}
+	energy := model.EnergyData{
+		Version:      1,
+		ID:           "zigbeePlug",
+		Date:         "2025-06-04",
+		TimezoneName: "Europe/Vienna",
+		Data:         data,
+	}
+	signReport(t, &energy)
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Implausible data")
+
+	// 0.5 kWh per interval is plausible, but not the 10 kWh since the last reading
+	data = make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{Value: 100 + float64(i)*0.5, Timestamp: intervalTimestamp(t, "2025-06-05", i)}
+	}
+	energy.Date = "2025-06-05"
+	energy.Data = data
+	signReport(t, &energy)
+	body, _ = json.Marshal(energy)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "since the last reading")
+	dbMock.AssertNotCalled(t, "ClaimReport", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
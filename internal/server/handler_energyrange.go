@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/influxdb"
+)
+
+// energyResolutions are the window lengths of an energy range request, windows are aligned to UTC
+var energyResolutions = map[string]time.Duration{
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// maxEnergyWindows limits the number of windows of an energy range request
+const maxEnergyWindows = 10000
+
+// EnergyRange is the energy of a device over a time range
+type EnergyRange struct {
+	ID         string         `json:"id"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Resolution string         `json:"resolution"`
+	Windows    []EnergyWindow `json:"windows"`
+}
+
+// EnergyWindow holds the cumulative registers of a device at the end of a window and their deltas.
+// A delta covers the energy since the last window with a value of the register, it is left out
+// if the register has no earlier value.
+type EnergyWindow struct {
+	Timestamp      time.Time `json:"timestamp"` // end of the window, readings stamped at it are included
+	EnergyKWh      *float64  `json:"energy_kwh,omitempty"`
+	DeltaKWh       *float64  `json:"delta_kwh,omitempty"`
+	ImportKWh      *float64  `json:"import_kwh,omitempty"`
+	ImportDeltaKWh *float64  `json:"import_delta_kwh,omitempty"`
+	ExportKWh      *float64  `json:"export_kwh,omitempty"`
+	ExportDeltaKWh *float64  `json:"export_delta_kwh,omitempty"`
+}
+
+// parseRangeTime parses an RFC 3339 timestamp or a date, which stands for midnight UTC.
+// A date as end of a range includes the whole day.
+func parseRangeTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// handleEnergyRange returns the energy of a device aggregated into windows, password protected
+func (s *Server) handleEnergyRange(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := parseRangeTime(query.Get("from"), false)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Invalid from, expected an RFC 3339 timestamp or YYYY-MM-DD"}, http.StatusBadRequest)
+		return
+	}
+	to, err := parseRangeTime(query.Get("to"), true)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Invalid to, expected an RFC 3339 timestamp or YYYY-MM-DD"}, http.StatusBadRequest)
+		return
+	}
+	resolution := query.Get("resolution")
+	if resolution == "" {
+		resolution = "15m"
+	}
+	every, ok := energyResolutions[resolution]
+	if !ok {
+		sendJSONResponse(w, Response{Error: "Invalid resolution, expected 15m, 1h or 1d"}, http.StatusBadRequest)
+		return
+	}
+	if !to.After(from) {
+		sendJSONResponse(w, Response{Error: "from must be before to"}, http.StatusBadRequest)
+		return
+	}
+	if !from.Truncate(every).Equal(from) || !to.Truncate(every).Equal(to) {
+		sendJSONResponse(w, Response{Error: "from and to must be aligned to the resolution in UTC"}, http.StatusBadRequest)
+		return
+	}
+	if windows := to.Sub(from) / every; windows > maxEnergyWindows {
+		sendJSONResponse(w, Response{Error: fmt.Sprintf("range must not exceed %d windows", maxEnergyWindows)}, http.StatusBadRequest)
+		return
+	}
+
+	_, found, err := s.db.GetDevice(deviceID)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Database error"}, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		sendJSONResponse(w, Response{Error: "Device not found"}, http.StatusNotFound)
+		return
+	}
+	if s.influxDBClient == nil {
+		sendJSONResponse(w, Response{Error: "InfluxDB is not configured"}, http.StatusServiceUnavailable)
+		return
+	}
+
+	// the window before the range is queried as well, it is the base of the first deltas.
+	// Windows are (start, stop], so the window labelled from holds the reading stamped at from.
+	points, err := s.influxDBClient.QueryRange(context.Background(), "energy_data",
+		map[string]string{"Inspelning": deviceID}, from.Add(-every), to, every, influxdb.AggregateLast)
+	if err != nil {
+		log.Printf("Failed to query energy data: %v", err)
+		sendJSONResponse(w, Response{Error: "Failed to query energy data"}, http.StatusInternalServerError)
+		return
+	}
+
+	result := EnergyRange{ID: deviceID, From: from, To: to, Resolution: resolution, Windows: energyWindows(points, from)}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Failed to encode energy range: %v", err)
+	}
+}
+
+// energyWindows turns the last values of consecutive windows into cumulative values and deltas,
+// windows ending at or before from only serve as base of the deltas
+func energyWindows(points []influxdb.RangePoint, from time.Time) []EnergyWindow {
+	windows := []EnergyWindow{}
+	var lastEnergy, lastImport, lastExport *float64
+	for _, point := range points {
+		window := EnergyWindow{Timestamp: point.Timestamp}
+		window.EnergyKWh, window.DeltaKWh = cumulative(fieldEnergy, point.Fields, &lastEnergy)
+		window.ImportKWh, window.ImportDeltaKWh = cumulative(fieldImport, point.Fields, &lastImport)
+		window.ExportKWh, window.ExportDeltaKWh = cumulative(fieldExport, point.Fields, &lastExport)
+		if point.Timestamp.After(from) {
+			windows = append(windows, window)
+		}
+	}
+	return windows
+}
+
+// cumulative reads a register of a window and its delta to the last value of the register, which it updates
+func cumulative(field energyField, fields map[string]interface{}, last **float64) (*float64, *float64) {
+	value, ok := field.get(fields)
+	if !ok {
+		return nil, nil
+	}
+	var delta *float64
+	if *last != nil {
+		d := value - **last
+		delta = &d
+	}
+	*last = &value
+	return &value, delta
+}
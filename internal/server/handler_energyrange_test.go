@@ -0,0 +1,138 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/planetmint"
+	"github.com/rddl-network/energy-service/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// rangeDeviceDB knows only the device zigbeeRange
+func rangeDeviceDB() *database.MockDatabase {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetDevice", "zigbeeRange").Return(database.Device{}, true, nil)
+	dbMock.On("GetDevice", mock.Anything).Return(database.Device{}, false, nil)
+	return dbMock
+}
+
+func TestEnergyRange(t *testing.T) {
+	from := time.Date(2025, 6, 4, 0, 0, 0, 0, time.UTC)
+	to := from.Add(3 * time.Hour)
+	influxMock := &influxdb.MockClient{}
+	influxMock.On("QueryRange", mock.Anything, "energy_data", map[string]string{"Inspelning": "zigbeeRange"},
+		from.Add(-time.Hour), to, time.Hour, influxdb.AggregateLast).Return([]influxdb.RangePoint{
+		{Timestamp: from, Fields: map[string]interface{}{"kW/h": 10.0}},
+		{Timestamp: from.Add(time.Hour), Fields: map[string]interface{}{"kW/h": 11.5, "energy_kwh": 11.5, "export_energy_kwh": 2.0}},
+		{Timestamp: from.Add(3 * time.Hour), Fields: map[string]interface{}{"energy_kwh": 14.0, "export_energy_kwh": 2.5}},
+	}, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, influxMock, rangeDeviceDB())
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/device/zigbeeRange/energy?pwd=testpwd&from=2025-06-04T00:00:00Z&to=2025-06-04T03:00:00Z&resolution=1h", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var result server.EnergyRange
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, "1h", result.Resolution)
+	// the window ending at from only serves as base of the first delta
+	assert.Len(t, result.Windows, 2)
+	assert.Equal(t, 11.5, *result.Windows[0].EnergyKWh)
+	assert.Equal(t, 1.5, *result.Windows[0].DeltaKWh)
+	assert.Nil(t, result.Windows[0].ExportDeltaKWh)
+	assert.Equal(t, 14.0, *result.Windows[1].EnergyKWh)
+	assert.Equal(t, 2.5, *result.Windows[1].DeltaKWh)
+	assert.Equal(t, 0.5, *result.Windows[1].ExportDeltaKWh)
+	assert.Nil(t, result.Windows[1].ImportKWh)
+}
+
+func TestEnergyRange_Dates(t *testing.T) {
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	influxMock := &influxdb.MockClient{}
+	influxMock.On("QueryRange", mock.Anything, "energy_data", mock.Anything,
+		from.Add(-24*time.Hour), from.AddDate(0, 0, 30), 24*time.Hour, influxdb.AggregateLast).Return([]influxdb.RangePoint{}, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, influxMock, rangeDeviceDB())
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/device/zigbeeRange/energy?pwd=testpwd&from=2025-06-01&to=2025-06-30&resolution=1d", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":"zigbeeRange","from":"2025-06-01T00:00:00Z","to":"2025-07-01T00:00:00Z","resolution":"1d","windows":[]}`, rr.Body.String())
+	influxMock.AssertExpectations(t)
+}
+
+func TestEnergyRange_InvalidRequests(t *testing.T) {
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, rangeDeviceDB())
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"from=2025-06-01&to=2025-06-02", http.StatusUnauthorized},
+		{"pwd=testpwd&from=yesterday&to=2025-06-02", http.StatusBadRequest},
+		{"pwd=testpwd&from=2025-06-01&to=2025-06-02&resolution=5m", http.StatusBadRequest},
+		{"pwd=testpwd&from=2025-06-03&to=2025-06-02", http.StatusBadRequest},
+		{"pwd=testpwd&from=2025-06-01T00:10:00Z&to=2025-06-02&resolution=1h", http.StatusBadRequest},
+		{"pwd=testpwd&from=2020-01-01&to=2025-06-02&resolution=15m", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/device/zigbeeRange/energy?"+tt.query, nil))
+		assert.Equal(t, tt.code, rr.Code, tt.query)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/device/unknown/energy?pwd=testpwd&from=2025-06-01&to=2025-06-02", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestEnergyRange_MemoryBackend(t *testing.T) {
+	db, err := database.NewDatabase(config.DatabaseConfig{Path: t.TempDir() + "/devices.db"})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddDevice("zigbeeMemory", "liq1", "Plug", "plug", "plmnt1", testDevicePublicKey()))
+	influxClient, err := influxdb.NewMemoryClient("")
+	assert.NoError(t, err)
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeMemory").Return(true, nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxClient, db)
+
+	// the whole upload and query path runs without an InfluxDB
+	rr := postDailyReport(t, mux, "zigbeeMemory", "2025-06-04", func(i int) float64 { return float64(20 + i) })
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/device/zigbeeMemory/energy?pwd=testpwd&from=2025-06-04&to=2025-06-04&resolution=1d", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var result server.EnergyRange
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	if assert.Len(t, result.Windows, 1) {
+		assert.Equal(t, 115.0, *result.Windows[0].EnergyKWh)
+		assert.NotNil(t, result.Windows[0].DeltaKWh)
+	}
+
+	// each 15 minute window is labelled with the timestamp of the reading it reports
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/device/zigbeeMemory/energy?pwd=testpwd&from=2025-06-03T21:45:00Z&to=2025-06-04T00:00:00Z&resolution=15m", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	result = server.EnergyRange{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	if assert.Len(t, result.Windows, 9) {
+		for i, window := range result.Windows {
+			assert.Equal(t, time.Time(intervalTimestamp(t, "2025-06-04", i)).UTC(), window.Timestamp)
+			assert.Equal(t, float64(20+i), *window.EnergyKWh)
+		}
+	}
+
+	last, err := influxClient.GetLastPoint(context.Background(), "energy_data", map[string]string{"Inspelning": "zigbeeMemory"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, last) {
+		assert.Equal(t, time.Time(intervalTimestamp(t, "2025-06-04", 95)).UTC(), last.Timestamp)
+	}
+}
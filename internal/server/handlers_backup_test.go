@@ -0,0 +1,48 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/planetmint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleBackup(t *testing.T) {
+	db, err := database.NewDatabase(config.DatabaseConfig{Path: t.TempDir() + "/devices.db"})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddDevice("zigbeeBak", "liq1", "Plug", "plug", "plmnt1", ""))
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, db)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/backup?pwd=wrong", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/backup?pwd=testpwd", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/gzip", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+
+	restoreCfg := config.DatabaseConfig{Path: t.TempDir() + "/restored.db"}
+	_, err = database.Restore(bytes.NewReader(rr.Body.Bytes()), restoreCfg)
+	assert.NoError(t, err)
+	restored, err := database.NewDatabase(restoreCfg)
+	assert.NoError(t, err)
+	defer restored.Close()
+	_, found, err := restored.GetDevice("zigbeeBak")
+	assert.NoError(t, err)
+	assert.True(t, found)
+}
+
+func TestHandleBackup_Unsupported(t *testing.T) {
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/backup?pwd=testpwd", nil))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/model"
+)
+
+// changedBy names the author of a device change. All admins share the password, so the client
+// address is the only thing the request tells about its author.
+func changedBy(r *http.Request) string {
+	return r.RemoteAddr
+}
+
+// handleUpdateDevice changes the name, type, addresses or public key of a device, password protected
+func (s *Server) handleUpdateDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		LiquidAddress     string `json:"liquid_address"`
+		DeviceName        string `json:"device_name"`
+		DeviceType        string `json:"device_type"`
+		PlanetmintAddress string `json:"planetmint_address"`
+		PublicKey         string `json:"public_key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendJSONResponse(w, Response{Error: "Invalid JSON data"}, http.StatusBadRequest)
+		return
+	}
+	if request.LiquidAddress == "" && request.DeviceName == "" && request.DeviceType == "" && request.PlanetmintAddress == "" && request.PublicKey == "" {
+		sendJSONResponse(w, Response{Error: "Nothing to update"}, http.StatusBadRequest)
+		return
+	}
+	if request.DeviceType != "" {
+		if _, known := deviceTypeLimits(request.DeviceType); !known {
+			sendJSONResponse(w, Response{Error: "Unknown device type " + request.DeviceType}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	device, found, err := s.db.GetDevice(deviceID)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Database error"}, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		sendJSONResponse(w, Response{Error: "Device not found"}, http.StatusNotFound)
+		return
+	}
+
+	// The public key, new or registered, has to match the Planetmint address the device ends up with
+	publicKey, plmntAddress := device.PublicKey, device.PlanetmintAddress
+	if request.PublicKey != "" {
+		publicKey = request.PublicKey
+	}
+	if request.PlanetmintAddress != "" {
+		plmntAddress = request.PlanetmintAddress
+	}
+	if publicKey != "" {
+		keyAddress, err := model.PlanetmintAddress(publicKey)
+		if err != nil {
+			sendJSONResponse(w, Response{Error: "Invalid public key: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if keyAddress != plmntAddress {
+			sendJSONResponse(w, Response{Error: "Public key does not match Planetmint address"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	device, err = s.db.UpdateDevice(deviceID, request.LiquidAddress, request.DeviceName, request.DeviceType, request.PlanetmintAddress, request.PublicKey, changedBy(r))
+	if err == database.ErrDeviceNotFound {
+		sendJSONResponse(w, Response{Error: "Device not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update device %s: %v", deviceID, err)
+		sendJSONResponse(w, Response{Error: "Failed to update device"}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(device); err != nil {
+		log.Printf("Failed to encode device: %v", err)
+	}
+}
+
+// handleDeleteDevice deregisters a device, password protected
+func (s *Server) handleDeleteDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.db.DeleteDevice(deviceID, changedBy(r))
+	if err == database.ErrDeviceNotFound {
+		sendJSONResponse(w, Response{Error: "Device not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete device %s: %v", deviceID, err)
+		sendJSONResponse(w, Response{Error: "Failed to delete device"}, http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, Response{Message: fmt.Sprintf("Device %s deregistered", deviceID)}, http.StatusOK)
+}
+
+// handleDeviceHistory lists the changes of a device, also after it was deregistered, password protected
+func (s *Server) handleDeviceHistory(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	history, err := s.db.GetDeviceHistory(deviceID)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Failed to retrieve device history"}, http.StatusInternalServerError)
+		return
+	}
+	if len(history) == 0 {
+		_, found, err := s.db.GetDevice(deviceID)
+		if err != nil {
+			sendJSONResponse(w, Response{Error: "Database error"}, http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			sendJSONResponse(w, Response{Error: "Device not found"}, http.StatusNotFound)
+			return
+		}
+		history = []database.DeviceChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		log.Printf("Failed to encode device history: %v", err)
+	}
+}
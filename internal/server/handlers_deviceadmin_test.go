@@ -0,0 +1,133 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/model"
+	"github.com/rddl-network/energy-service/internal/planetmint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateDevice(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetDevice", "dev123").Return(database.Device{DeviceName: "Plug", DeviceType: "plug"}, true, nil)
+	dbMock.On("UpdateDevice", "dev123", "liq2", "Kitchen Plug", "", "", "", "192.0.2.1:1234").
+		Return(database.Device{DeviceName: "Kitchen Plug", LiquidAddress: "liq2", DeviceType: "plug"}, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	body := `{"device_name": "Kitchen Plug", "liquid_address": "liq2"}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/device/dev123?pwd=testpwd", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var device database.Device
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &device))
+	assert.Equal(t, "Kitchen Plug", device.DeviceName)
+	dbMock.AssertExpectations(t)
+}
+
+func TestUpdateDevice_Unauthorized(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/device/dev123?pwd=wrong", bytes.NewBufferString(`{"device_name": "x"}`))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	dbMock.AssertNotCalled(t, "UpdateDevice", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateDevice_PublicKeyMismatch(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetDevice", "dev123").Return(database.Device{PublicKey: testDevicePublicKey()}, true, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/device/dev123?pwd=testpwd", bytes.NewBufferString(`{"planetmint_address": "plmnt1other"}`))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Public key does not match")
+}
+
+func TestUpdateDevice_SetPublicKey(t *testing.T) {
+	address, err := model.PlanetmintAddress(testDevicePublicKey())
+	require.NoError(t, err)
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetDevice", "dev123").Return(database.Device{PlanetmintAddress: address}, true, nil)
+	dbMock.On("GetDevice", "dev456").Return(database.Device{PlanetmintAddress: "plmnt1other"}, true, nil)
+	dbMock.On("UpdateDevice", "dev123", "", "", "", "", testDevicePublicKey(), "192.0.2.1:1234").
+		Return(database.Device{PlanetmintAddress: address, PublicKey: testDevicePublicKey()}, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	body := `{"public_key": "` + testDevicePublicKey() + `"}`
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/api/device/dev123?pwd=testpwd", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	dbMock.AssertCalled(t, "UpdateDevice", "dev123", "", "", "", "", testDevicePublicKey(), "192.0.2.1:1234")
+
+	// the key has to derive to the address of the device
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/api/device/dev456?pwd=testpwd", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Public key does not match")
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/api/device/dev456?pwd=testpwd", bytes.NewBufferString(`{"public_key": "abcd"}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid public key")
+}
+
+func TestDeleteDevice(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("DeleteDevice", "dev123", "192.0.2.1:1234").Return(nil)
+	dbMock.On("DeleteDevice", "unknown", "192.0.2.1:1234").Return(database.ErrDeviceNotFound)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/device/dev123?pwd=testpwd", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Device dev123 deregistered")
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/device/unknown?pwd=testpwd", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestDeviceHistory(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetDeviceHistory", "dev123").Return([]database.DeviceChange{{
+		Action:    database.DeviceChangeDelete,
+		Previous:  database.Device{DeviceName: "Plug"},
+		ChangedBy: "alice",
+		ChangedAt: time.Date(2025, 6, 4, 8, 0, 0, 0, time.UTC),
+	}}, nil)
+	dbMock.On("GetDeviceHistory", "unknown").Return([]database.DeviceChange(nil), nil)
+	dbMock.On("GetDevice", "unknown").Return(database.Device{}, false, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/device/dev123/history?pwd=testpwd", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var history []database.DeviceChange
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+	assert.Len(t, history, 1)
+	assert.Equal(t, "alice", history[0].ChangedBy)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/device/unknown/history?pwd=testpwd", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
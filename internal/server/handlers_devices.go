@@ -2,10 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
 )
 
 // handleGetDevices returns all devices in the database
@@ -26,7 +29,11 @@ func (s *Server) handleGetDevices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	devices, err := s.db.GetAllDevices()
+	devices, err := s.lookupDevices(r.URL.Query())
+	if err == errAmbiguousDeviceFilter {
+		sendJSONResponse(w, Response{Error: err.Error()}, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		sendJSONResponse(w, Response{Error: "Failed to retrieve devices"}, http.StatusInternalServerError)
 		return
@@ -41,6 +48,70 @@ func (s *Server) handleGetDevices(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+var errAmbiguousDeviceFilter = errors.New("only one of liquid_address, planetmint_address and device_type may be given")
+
+// lookupDevices returns the devices matching the liquid_address, planetmint_address or
+// device_type query parameter, or all devices if none is given
+func (s *Server) lookupDevices(query url.Values) (map[string]database.Device, error) {
+	filters := map[string]func(string) (map[string]database.Device, error){
+		"liquid_address":     s.db.GetByLiquidAddress,
+		"planetmint_address": s.db.GetByPlanetmintAddress,
+		"device_type":        s.db.GetByDeviceType,
+	}
+
+	var lookup func(string) (map[string]database.Device, error)
+	var value string
+	for param, filter := range filters {
+		if !query.Has(param) {
+			continue
+		}
+		if lookup != nil {
+			return nil, errAmbiguousDeviceFilter
+		}
+		lookup, value = filter, query.Get(param)
+	}
+	if lookup == nil {
+		return s.db.GetAllDevices()
+	}
+	return lookup(value)
+}
+
+// handleDevice dispatches requests below /api/device/ to the device sub-resources
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) == 4 && parts[3] != "" {
+		switch r.Method {
+		case http.MethodPatch:
+			s.handleUpdateDevice(w, r, parts[3])
+			return
+		case http.MethodDelete:
+			s.handleDeleteDevice(w, r, parts[3])
+			return
+		}
+	}
+	if len(parts) == 5 && parts[3] != "" {
+		switch parts[4] {
+		case "reset":
+			s.handleMeterReset(w, r, parts[3])
+			return
+		case "history":
+			s.handleDeviceHistory(w, r, parts[3])
+			return
+		case "reports":
+			s.handleReportCalendar(w, r, parts[3])
+			return
+		case "energy":
+			s.handleEnergyRange(w, r, parts[3])
+			return
+		}
+	}
+	if len(parts) == 6 && parts[3] != "" && parts[4] == "reports" {
+		s.handleReportRecord(w, r, parts[3], parts[5])
+		return
+	}
+	s.HandleIsDeviceRegistered(w, r)
+}
+
 func (s *Server) HandleIsDeviceRegistered(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1,6 +1,7 @@
 package server_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,31 +11,14 @@ import (
 	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/influxdb"
 	"github.com/rddl-network/energy-service/internal/planetmint"
-	"github.com/rddl-network/energy-service/internal/server"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
 )
 
-func setTestConfig(cfg *config.Config) {
-	config.ConfigTestOnly = &cfg
-}
-
 func setupServerWithPwd(t *testing.T, pwd string) *http.ServeMux {
-	cfg, err := config.LoadConfig("")
-	assert.NoError(t, err, "Failed to load configuration")
-	cfg.Server.Password = pwd
-	setTestConfig(cfg)
-	mockInflux := &influxdb.MockClient{}
-	mockInflux.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
-	mockInflux.On("Close").Return()
-	mockPlmntclient := &planetmint.MockPlanetmintClient{}
 	mockDB := &database.MockDatabase{}
 	mockDB.On("GetAllDevices").Return(map[string]database.Device{}, nil)
-	srv, err := server.NewServer(mockPlmntclient, mockInflux, mockDB)
-	assert.NoError(t, err)
-	mux := http.NewServeMux()
-	srv.Routes(mux)
-	t.Cleanup(func() { srv.Close() })
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, mockDB)
+	config.GetConfig().Server.Password = pwd
 	return mux
 }
 
@@ -70,18 +54,50 @@ func TestGetDevices_NoPasswordSetInService(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
 
+func TestGetDevices_ByLiquidAddress(t *testing.T) {
+	mockDB := &database.MockDatabase{}
+	mockDB.On("GetByLiquidAddress", "liq1").Return(map[string]database.Device{
+		"dev1": {LiquidAddress: "liq1", DeviceName: "Plug"},
+	}, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, mockDB)
+	req := httptest.NewRequest("GET", "/api/devices?pwd=testpwd&liquid_address=liq1", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var devices map[string]database.Device
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &devices))
+	assert.Equal(t, "Plug", devices["dev1"].DeviceName)
+	mockDB.AssertNotCalled(t, "GetAllDevices")
+}
+
+func TestGetDevices_ByDeviceType(t *testing.T) {
+	mockDB := &database.MockDatabase{}
+	mockDB.On("GetByDeviceType", "plug").Return(map[string]database.Device{}, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, mockDB)
+	req := httptest.NewRequest("GET", "/api/devices?pwd=testpwd&device_type=plug", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, "{}", rr.Body.String())
+}
+
+func TestGetDevices_MultipleFilters(t *testing.T) {
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
+	req := httptest.NewRequest("GET", "/api/devices?pwd=testpwd&liquid_address=liq1&device_type=plug", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
 func TestHandleIsDeviceRegistered_PathParsing(t *testing.T) {
 	mockInflux := &influxdb.MockClient{}
 	mockPlmntclient := &planetmint.MockPlanetmintClient{}
 	mockDB := &database.MockDatabase{}
 	// Device exists
 	mockDB.On("GetDevice", "dev123").Return(database.Device{LiquidAddress: "Liquid_address", DeviceName: "dev123", DeviceType: "washing machine", PlanetmintAddress: "plmnt...", Timestamp: time.Now()}, true, nil)
-	srv, err := server.NewServer(mockPlmntclient, mockInflux, mockDB)
-	assert.NoError(t, err)
-	mux := http.NewServeMux()
-	srv.Routes(mux)
+	srv, mux := setupEnergyTestServer(t, mockPlmntclient, mockInflux, mockDB)
 	mux.HandleFunc("/api/device/", srv.HandleIsDeviceRegistered)
-	//t.Cleanup(func() { srv.Close() })
 
 	// Valid path: /api/device/dev123
 	req := httptest.NewRequest("GET", "/api/device/dev123", nil)
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/model"
+)
+
+// handleMeterReset records (POST) or lists (GET) meter reset events of a device, password protected
+func (s *Server) handleMeterReset(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	_, found, err := s.db.GetDevice(deviceID)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Database error"}, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		sendJSONResponse(w, Response{Error: "Device not found"}, http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		resets, err := s.db.GetMeterResets(deviceID)
+		if err != nil {
+			sendJSONResponse(w, Response{Error: "Failed to retrieve meter resets"}, http.StatusInternalServerError)
+			return
+		}
+		if resets == nil {
+			resets = []database.MeterReset{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resets); err != nil {
+			log.Printf("Failed to encode meter resets: %v", err)
+		}
+		return
+	}
+
+	var request struct {
+		Baseline       *float64         `json:"baseline"`
+		ImportBaseline *float64         `json:"import_baseline"`
+		ExportBaseline *float64         `json:"export_baseline"`
+		ResetAt        *model.TimeStamp `json:"reset_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendJSONResponse(w, Response{Error: "Invalid JSON data"}, http.StatusBadRequest)
+		return
+	}
+	if request.Baseline == nil || *request.Baseline < 0 {
+		sendJSONResponse(w, Response{Error: "A non-negative baseline is required"}, http.StatusBadRequest)
+		return
+	}
+	if (request.ImportBaseline != nil && *request.ImportBaseline < 0) || (request.ExportBaseline != nil && *request.ExportBaseline < 0) {
+		sendJSONResponse(w, Response{Error: "Import and export baselines must not be negative"}, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	reset := database.MeterReset{
+		Baseline:       *request.Baseline,
+		ImportBaseline: request.ImportBaseline,
+		ExportBaseline: request.ExportBaseline,
+		ResetAt:        now,
+		RecordedAt:     now,
+	}
+	if request.ResetAt != nil {
+		reset.ResetAt = time.Time(*request.ResetAt)
+	}
+
+	if err := s.db.AddMeterReset(deviceID, reset); err != nil {
+		log.Printf("Failed to store meter reset: %v", err)
+		sendJSONResponse(w, Response{Error: "Failed to store meter reset"}, http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, Response{Message: fmt.Sprintf("Meter reset recorded for device %s", deviceID)}, http.StatusCreated)
+}
+
+// lastMeterReset returns the most recent meter reset of the reporting device that happened
+// before the end of the report, or nil if there is none
+func (s *Server) lastMeterReset(data model.EnergyData) (*database.MeterReset, error) {
+	resets, err := s.db.GetMeterResets(data.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Data) == 0 {
+		return nil, nil
+	}
+	end := time.Time(data.Data[len(data.Data)-1].Timestamp)
+
+	var last *database.MeterReset
+	for i := range resets {
+		if resets[i].ResetAt.After(end) {
+			continue
+		}
+		if last == nil || resets[i].ResetAt.After(last.ResetAt) {
+			last = &resets[i]
+		}
+	}
+	return last, nil
+}
+
+// isEnergyDataIncreasing checks the registers of a report for monotonicity, allowing a drop at the meter reset
+// down to the baselines, which are given in kWh
+func isEnergyDataIncreasing(data model.EnergyData, reset *database.MeterReset) bool {
+	if reset == nil {
+		return model.IsEnergyDataIncreasing(data.Data)
+	}
+	normalized, err := data.Normalized()
+	if err != nil {
+		return false
+	}
+	return model.IsEnergyDataIncreasingWithReset(normalized.Data, reset.ResetAt, resetBaseline(reset))
+}
@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/model"
+	"github.com/rddl-network/energy-service/internal/planetmint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMeterReset_Unauthorized(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest("POST", "/api/device/dev123/reset?pwd=wrong", bytes.NewBufferString(`{"baseline": 0}`))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	dbMock.AssertNotCalled(t, "AddMeterReset", mock.Anything, mock.Anything)
+}
+
+func TestMeterReset_Record(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetDevice", "dev123").Return(database.Device{DeviceName: "dev123"}, true, nil)
+	resetAt := time.Date(2025, 6, 4, 8, 0, 0, 0, time.UTC)
+	dbMock.On("AddMeterReset", "dev123", mock.MatchedBy(func(reset database.MeterReset) bool {
+		return reset.Baseline == 5 && reset.ImportBaseline != nil && *reset.ImportBaseline == 3 &&
+			reset.ExportBaseline == nil && reset.ResetAt.Equal(resetAt)
+	})).Return(nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	body := `{"baseline": 5, "import_baseline": 3, "reset_at": "2025-06-04 08:00:00"}`
+	req := httptest.NewRequest("POST", "/api/device/dev123/reset?pwd=testpwd", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Meter reset recorded")
+	dbMock.AssertExpectations(t)
+}
+
+func TestMeterReset_UnknownDevice(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetDevice", "unknown").Return(database.Device{}, false, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest("POST", "/api/device/unknown/reset?pwd=testpwd", bytes.NewBufferString(`{"baseline": 5}`))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleEnergyData_AfterMeterReset(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeReset").Return(true, nil)
+	dbMock.On("GetDevice", "zigbeeReset").Return(database.Device{PublicKey: testDevicePublicKey()}, true, nil)
+	dbMock.On("GetReportStatus", "zigbeeReset", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeReset", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeReset", "2025-06-04", reportWithStatus("valid")).Return(nil)
+	// the meter was swapped during the night before the report
+	dbMock.On("GetMeterResets", "zigbeeReset").Return([]database.MeterReset{{
+		Baseline: 2,
+		ResetAt:  time.Date(2025, 6, 3, 20, 0, 0, 0, time.UTC),
+	}}, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+	dbMock.On("GetLastReading", "zigbeeReset").Return(database.LastReading{
+		EnergyKWh: 5000,
+		Timestamp: time.Date(2025, 6, 3, 19, 0, 0, 0, time.UTC),
+	}, true, nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{
+			Value:     2 + float64(i),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
+		}
+	}
+	energy := model.EnergyData{
+		Version:      1,
+		ID:           "zigbeeReset",
+		Date:         "2025-06-04",
+		TimezoneName: "Europe/Vienna",
+		Data:         data,
+	}
+	signReport(t, &energy)
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestHandleEnergyData_AfterMeterResetInWh(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeResetWh").Return(true, nil)
+	dbMock.On("GetDevice", "zigbeeResetWh").Return(database.Device{PublicKey: testDevicePublicKey()}, true, nil)
+	dbMock.On("GetReportStatus", "zigbeeResetWh", "2025-06-04").Return("", nil)
+	// the baseline of 2 kWh is 2000 Wh in the unit of the device
+	dbMock.On("GetMeterResets", "zigbeeResetWh").Return([]database.MeterReset{{
+		Baseline: 2,
+		ResetAt:  time.Date(2025, 6, 3, 20, 0, 0, 0, time.UTC),
+	}}, nil)
+	dbMock.On("GetLastReading", "zigbeeResetWh").Return(database.LastReading{
+		EnergyKWh: 5000,
+		Timestamp: time.Date(2025, 6, 3, 19, 0, 0, 0, time.UTC),
+	}, true, nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	for _, tc := range []struct {
+		first float64
+		code  int
+	}{
+		{first: 1500, code: http.StatusConflict},
+		{first: 2500, code: http.StatusOK},
+	} {
+		if tc.code == http.StatusOK {
+			dbMock.On("ClaimReport", "zigbeeResetWh", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+			dbMock.On("SetReportRecord", "zigbeeResetWh", "2025-06-04", reportWithStatus("valid")).Return(nil)
+			influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+		}
+		data := make([]model.EnergyTuple, 96)
+		for i := range data {
+			data[i] = model.EnergyTuple{Value: tc.first + float64(i)*10, Timestamp: intervalTimestamp(t, "2025-06-04", i)}
+		}
+		energy := model.EnergyData{
+			Version:      2,
+			ID:           "zigbeeResetWh",
+			Date:         "2025-06-04",
+			TimezoneName: "Europe/Vienna",
+			Unit:         model.UnitWh,
+			Data:         data,
+		}
+		signReport(t, &energy)
+		body, _ := json.Marshal(energy)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body)))
+		assert.Equal(t, tc.code, rr.Code, "first value %v Wh", tc.first)
+	}
+}
+
+func TestHandleEnergyData_AfterMeterResetWithImportBaseline(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeResetImport").Return(true, nil)
+	dbMock.On("GetDevice", "zigbeeResetImport").Return(database.Device{PublicKey: testDevicePublicKey()}, true, nil)
+	dbMock.On("GetReportStatus", "zigbeeResetImport", "2025-06-04").Return("", nil)
+	importBaseline := 3.0
+	dbMock.On("GetMeterResets", "zigbeeResetImport").Return([]database.MeterReset{{
+		Baseline:       2,
+		ImportBaseline: &importBaseline,
+		ResetAt:        time.Date(2025, 6, 3, 20, 0, 0, 0, time.UTC),
+	}}, nil)
+	lastImport := 4000.0
+	dbMock.On("GetLastReading", "zigbeeResetImport").Return(database.LastReading{
+		EnergyKWh: 5000,
+		ImportKWh: &lastImport,
+		Timestamp: time.Date(2025, 6, 3, 19, 0, 0, 0, time.UTC),
+	}, true, nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	for _, tc := range []struct {
+		firstImport float64
+		code        int
+	}{
+		{firstImport: 2.5, code: http.StatusConflict},
+		{firstImport: 3, code: http.StatusOK},
+	} {
+		if tc.code == http.StatusOK {
+			dbMock.On("ClaimReport", "zigbeeResetImport", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+			dbMock.On("SetReportRecord", "zigbeeResetImport", "2025-06-04", reportWithStatus("valid")).Return(nil)
+			influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+		}
+		data := make([]model.EnergyTuple, 96)
+		for i := range data {
+			imported := tc.firstImport + float64(i)*0.01
+			data[i] = model.EnergyTuple{Value: 2 + float64(i)*0.01, Import: &imported, Timestamp: intervalTimestamp(t, "2025-06-04", i)}
+		}
+		energy := model.EnergyData{
+			Version:      2,
+			ID:           "zigbeeResetImport",
+			Date:         "2025-06-04",
+			TimezoneName: "Europe/Vienna",
+			Data:         data,
+		}
+		signReport(t, &energy)
+		body, _ := json.Marshal(energy)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body)))
+		assert.Equal(t, tc.code, rr.Code, "first import %v kWh", tc.firstImport)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/rddl-network/energy-service/internal/model"
+	service "github.com/rddl-network/energy-service/internal/planetmint"
 )
 
 // handleRegister handles device registration requests
@@ -20,6 +23,7 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		DeviceName        string `json:"device_name"`
 		PlanetmintAddress string `json:"planetmint_address"`
 		DeviceType        string `json:"device_type"`
+		PublicKey         string `json:"public_key"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -34,8 +38,9 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	plmntAddress := formData.PlanetmintAddress
 	deviceName := formData.DeviceName
 	deviceType := formData.DeviceType
+	publicKey := formData.PublicKey
 
-	metadataJson := "{ \"Device\": \"}" + deviceName + "\"}"
+	metadataJson := service.DERMetadata(deviceName)
 
 	// Validate form data
 	if id == "" || liquidAddress == "" || deviceName == "" || deviceType == "" || plmntAddress == "" {
@@ -43,12 +48,30 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, known := deviceTypeLimits(deviceType); !known {
+		sendJSONResponse(w, Response{Error: "Unknown device type " + deviceType}, http.StatusBadRequest)
+		return
+	}
+
 	// Validate Zigbee ID format
 	if !s.utils.IsValidID(id) {
 		sendJSONResponse(w, Response{Error: "Invalid ID format"}, http.StatusBadRequest)
 		return
 	}
 
+	// The optional public key used to verify reports has to belong to the Planetmint address
+	if publicKey != "" {
+		keyAddress, err := model.PlanetmintAddress(publicKey)
+		if err != nil {
+			sendJSONResponse(w, Response{Error: "Invalid public key: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if keyAddress != plmntAddress {
+			sendJSONResponse(w, Response{Error: "Public key does not match Planetmint address"}, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Check if Zigbee ID already exists
 	_, existsDB, err := s.db.GetDevice(id)
 	if err != nil {
@@ -71,7 +94,7 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add device to database
-	err = s.db.AddDevice(id, liquidAddress, deviceName, deviceType, plmntAddress)
+	err = s.db.AddDevice(id, liquidAddress, deviceName, deviceType, plmntAddress, publicKey)
 	if err != nil {
 		sendJSONResponse(w, Response{Error: "Failed to add device"}, http.StatusInternalServerError)
 		return
@@ -2,15 +2,18 @@ package server_test
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
 	"github.com/rddl-network/energy-service/internal/config"
 	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/model"
 	"github.com/rddl-network/energy-service/internal/planetmint"
 	"github.com/rddl-network/energy-service/internal/server"
 	"github.com/stretchr/testify/assert"
@@ -18,15 +21,7 @@ import (
 )
 
 func setupRegisterTestServer(t *testing.T, plmntMock *planetmint.MockPlanetmintClient, dbMock *database.MockDatabase) (*server.Server, *http.ServeMux) {
-	cfg := config.DefaultConfig()
-	config.ConfigTestOnly = &cfg
-	mockInflux := &influxdb.MockClient{}
-	srv, err := server.NewServer(plmntMock, mockInflux, dbMock)
-	assert.NoError(t, err)
-	mux := http.NewServeMux()
-	srv.Routes(mux)
-	t.Cleanup(func() { srv.Close() })
-	return srv, mux
+	return setupEnergyTestServer(t, plmntMock, &influxdb.MockClient{}, dbMock)
 }
 
 func TestRegister_InvalidJSON(t *testing.T) {
@@ -155,7 +150,7 @@ func TestRegister_Success(t *testing.T) {
 	dbMock := &database.MockDatabase{}
 	validID := "bb0773daa6dc31d6accf9c1b1086a174a33417ac924f51813cf702e344d9ffa6"
 	dbMock.On("GetDevice", validID).Return(database.Device{}, false, nil)
-	dbMock.On("AddDevice", validID, "liq1", "dev1", "type1", "plmnt1").Return(nil)
+	dbMock.On("AddDevice", validID, "liq1", "dev1", "type1", "plmnt1", "").Return(nil)
 	plmntMock.On("IsZigbeeRegistered", validID).Return(false, nil)
 	plmntMock.On("RegisterDER", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	_, mux := setupRegisterTestServer(t, plmntMock, dbMock)
@@ -180,7 +175,7 @@ func TestRegister_Success_and_Query(t *testing.T) {
 	dbMock := &database.MockDatabase{}
 	validID := "bb0773daa6dc31d6accf9c1b1986a174a33417ac924f51813cf702e344d9ffa6"
 	dbMock.On("GetDevice", validID).Return(database.Device{}, false, nil)
-	dbMock.On("AddDevice", validID, "liq1", "dev1", "type1", "plmnt1").Return(nil)
+	dbMock.On("AddDevice", validID, "liq1", "dev1", "type1", "plmnt1", "").Return(nil)
 	plmntMock.On("IsZigbeeRegistered", validID).Return(false, nil)
 	plmntMock.On("RegisterDER", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	_, mux := setupRegisterTestServer(t, plmntMock, dbMock)
@@ -199,3 +194,75 @@ func TestRegister_Success_and_Query(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, rr.Code)
 	assert.Contains(t, rr.Body.String(), "registered successfully")
 }
+
+func TestRegister_PublicKeyMismatch(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	dbMock := &database.MockDatabase{}
+	_, mux := setupRegisterTestServer(t, plmntMock, dbMock)
+	pubKey := secp256k1.GenPrivKeyFromSecret([]byte("register-test")).PubKey()
+	form := map[string]interface{}{
+		"id":                 "bb0773daa6dc31d6accf9c1b1086a174a33417ac924f51813cf702e344d9ffa6",
+		"liquid_address":     "liq1",
+		"device_name":        "dev1",
+		"planetmint_address": "plmnt1",
+		"device_type":        "type1",
+		"public_key":         hex.EncodeToString(pubKey.Bytes()),
+	}
+	body, _ := json.Marshal(form)
+	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Public key does not match Planetmint address")
+}
+
+func TestRegister_SuccessWithPublicKey(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	dbMock := &database.MockDatabase{}
+	validID := "bb0773daa6dc31d6accf9c1b1086a174a33417ac924f51813cf702e344d9ffa6"
+	pubKeyHex := hex.EncodeToString(secp256k1.GenPrivKeyFromSecret([]byte("register-test")).PubKey().Bytes())
+	plmntAddress, err := model.PlanetmintAddress(pubKeyHex)
+	assert.NoError(t, err)
+	dbMock.On("GetDevice", validID).Return(database.Device{}, false, nil)
+	dbMock.On("AddDevice", validID, "liq1", "dev1", "type1", plmntAddress, pubKeyHex).Return(nil)
+	plmntMock.On("IsZigbeeRegistered", validID).Return(false, nil)
+	plmntMock.On("RegisterDER", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	_, mux := setupRegisterTestServer(t, plmntMock, dbMock)
+	form := map[string]interface{}{
+		"id":                 validID,
+		"liquid_address":     "liq1",
+		"device_name":        "dev1",
+		"planetmint_address": plmntAddress,
+		"device_type":        "type1",
+		"public_key":         pubKeyHex,
+	}
+	body, _ := json.Marshal(form)
+	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	dbMock.AssertExpectations(t)
+}
+
+func TestRegister_UnknownDeviceType(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	dbMock := &database.MockDatabase{}
+	_, mux := setupRegisterTestServer(t, plmntMock, dbMock)
+	withDeviceTypes(t, map[string]config.DeviceTypeConfig{"plug": {MaxPowerKW: 3.6}})
+	form := map[string]interface{}{
+		"id":                 "bb0773daa6dc31d6accf9c1b1086a174a33417ac924f51813cf702e344d9ffa6",
+		"liquid_address":     "liq1",
+		"device_name":        "dev1",
+		"planetmint_address": "plmnt1",
+		"device_type":        "nuclear-plant",
+	}
+	body, _ := json.Marshal(form)
+	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Unknown device type")
+}
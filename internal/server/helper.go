@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
 	"github.com/rddl-network/energy-service/internal/model"
 )
 
@@ -31,6 +33,199 @@ func (s *Server) writeJSON2File(data model.EnergyData) {
 	s.energyDataFileMutex.Unlock()
 }
 
+// energyField holds the legacy and the canonical InfluxDB field name of a cumulative energy register
+type energyField struct {
+	legacy    string
+	canonical string
+}
+
+var (
+	fieldEnergy = energyField{legacy: "kW/h", canonical: "energy_kwh"}
+	fieldImport = energyField{legacy: "import_kW/h", canonical: "import_energy_kwh"}
+	fieldExport = energyField{legacy: "export_kW/h", canonical: "export_energy_kwh"}
+)
+
+// set stores a kWh value under the field names selected by the configured field schema
+func (f energyField) set(fields map[string]interface{}, kwh float64) {
+	schema := config.GetConfig().InfluxDB.FieldSchema
+	if schema != config.FieldSchemaCanonical {
+		fields[f.legacy] = kwh
+	}
+	if schema == config.FieldSchemaCanonical || schema == config.FieldSchemaDual {
+		fields[f.canonical] = kwh
+	}
+}
+
+// get reads a kWh value from a stored point, preferring the canonical field name
+func (f energyField) get(fields map[string]interface{}) (float64, bool) {
+	if value, ok := fields[f.canonical].(float64); ok {
+		return value, true
+	}
+	value, ok := fields[f.legacy].(float64)
+	return value, ok
+}
+
+// isAboveLastReading checks that the first interval of a report does not fall below
+// the last accepted value of any of its registers. If the meter was reset after the last reading
+// and before the report starts, the first values are compared against the reset baselines instead.
+// All values are compared in kWh.
+func isAboveLastReading(data model.EnergyData, last *database.LastReading, reset *database.MeterReset) bool {
+	if len(data.Data) == 0 {
+		return true
+	}
+	normalized, err := data.Normalized()
+	if err != nil {
+		return false
+	}
+	first := normalized.Data[0]
+	if resetApplies(data, last, reset) {
+		baseline := resetBaseline(reset)
+		if first.Value < baseline.Value {
+			return false
+		}
+		if baseline.Import != nil && first.Import != nil && *first.Import < *baseline.Import {
+			return false
+		}
+		return baseline.Export == nil || first.Export == nil || *first.Export >= *baseline.Export
+	}
+	if last == nil {
+		return true
+	}
+	if first.Value < last.EnergyKWh {
+		return false
+	}
+	if last.ImportKWh != nil && first.Import != nil && *first.Import < *last.ImportKWh {
+		return false
+	}
+	if last.ExportKWh != nil && first.Export != nil && *first.Export < *last.ExportKWh {
+		return false
+	}
+	return true
+}
+
+// resetApplies tells whether the meter was reset after the last reading and before the report starts
+func resetApplies(data model.EnergyData, last *database.LastReading, reset *database.MeterReset) bool {
+	return reset != nil && len(data.Data) > 0 && (last == nil || reset.ResetAt.After(last.Timestamp)) &&
+		!time.Time(data.Data[0].Timestamp).Before(reset.ResetAt)
+}
+
+// resetBaseline returns the registers of a meter right after a reset, registers without a
+// recorded baseline are nil
+func resetBaseline(reset *database.MeterReset) model.EnergyTuple {
+	return model.EnergyTuple{
+		Value:     reset.Baseline,
+		Import:    reset.ImportBaseline,
+		Export:    reset.ExportBaseline,
+		Timestamp: model.TimeStamp(reset.ResetAt),
+	}
+}
+
+// plausibilityBase returns the reading the first interval of a report is checked against for
+// plausibility, nil if the device has none. After a meter reset this is the baseline at the reset.
+func plausibilityBase(data model.EnergyData, last *database.LastReading, reset *database.MeterReset) *model.EnergyTuple {
+	if resetApplies(data, last, reset) {
+		baseline := resetBaseline(reset)
+		return &baseline
+	}
+	if last == nil {
+		return nil
+	}
+	return &model.EnergyTuple{
+		Value:     last.EnergyKWh,
+		Import:    last.ImportKWh,
+		Export:    last.ExportKWh,
+		Timestamp: model.TimeStamp(last.Timestamp),
+	}
+}
+
+// lastDeviceStatus returns the last stored energy counter of a device status in kWh, or nil if there is none
+func (s *Server) lastDeviceStatus(id string) (*model.EnergyTuple, error) {
+	if s.influxDBClient == nil {
+		return nil, nil
+	}
+	lastPoint, err := s.influxDBClient.GetLastPoint(context.Background(), "device_status", map[string]string{"ID": id})
+	if err != nil || lastPoint == nil {
+		return nil, err
+	}
+	energy, ok := fieldEnergy.get(lastPoint.Fields)
+	if !ok {
+		return nil, nil
+	}
+	return &model.EnergyTuple{Value: energy, Timestamp: model.TimeStamp(lastPoint.Timestamp)}, nil
+}
+
+// lastReading returns the last accepted reading of the reporting device, or nil if it has none.
+// A device without a cached reading, e.g. after an upgrade, is looked up in InfluxDB once
+// and the cache is rebuilt from the result.
+func (s *Server) lastReading(data model.EnergyData) (*database.LastReading, error) {
+	reading, found, err := s.db.GetLastReading(data.ID)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return &reading, nil
+	}
+	if s.influxDBClient == nil {
+		return nil, nil
+	}
+
+	lastPoint, err := s.influxDBClient.GetLastPoint(context.Background(),
+		"energy_data",
+		map[string]string{
+			"Inspelning": data.ID,
+			"timezone":   data.TimezoneName,
+		})
+	if err != nil {
+		return nil, err
+	}
+	if lastPoint == nil {
+		return nil, nil
+	}
+	energy, ok := fieldEnergy.get(lastPoint.Fields)
+	if !ok {
+		return nil, nil
+	}
+	reading = database.LastReading{Timestamp: lastPoint.Timestamp.UTC(), EnergyKWh: energy}
+	if value, ok := fieldImport.get(lastPoint.Fields); ok {
+		reading.ImportKWh = &value
+	}
+	if value, ok := fieldExport.get(lastPoint.Fields); ok {
+		reading.ExportKWh = &value
+	}
+	if err := s.db.SetLastReading(data.ID, reading); err != nil {
+		log.Printf("Failed to cache last reading of %s: %v", data.ID, err)
+	}
+	return &reading, nil
+}
+
+// nextReading returns the reading after a report is accepted, registers the report
+// does not carry keep their last value
+func nextReading(last *database.LastReading, data model.EnergyData) (*database.LastReading, error) {
+	normalized, err := data.Normalized()
+	if err != nil {
+		return nil, err
+	}
+	if len(normalized.Data) == 0 {
+		return last, nil
+	}
+	final := normalized.Data[len(normalized.Data)-1]
+	reading := database.LastReading{
+		Timestamp: time.Time(final.Timestamp).UTC(),
+		EnergyKWh: final.Value,
+		ImportKWh: final.Import,
+		ExportKWh: final.Export,
+	}
+	if last != nil {
+		if reading.ImportKWh == nil {
+			reading.ImportKWh = last.ImportKWh
+		}
+		if reading.ExportKWh == nil {
+			reading.ExportKWh = last.ExportKWh
+		}
+	}
+	return &reading, nil
+}
+
 func (s *Server) write2InfluxDB(data model.EnergyData) error {
 	writeAPI := s.influxDBClient
 	if writeAPI == nil {
@@ -38,25 +233,53 @@ func (s *Server) write2InfluxDB(data model.EnergyData) error {
 		return nil
 	}
 
-	for i := 0; i < 96; i++ {
-		err := writeAPI.WritePoint(
-			context.Background(),
-			"energy_data",
-			map[string]string{
-				"Inspelning": data.ID,
-				"timezone":   data.TimezoneName,
-			},
-			map[string]interface{}{"kW/h": data.Data[i].Value},
-			time.Time(data.Data[i].Timestamp),
-		)
-		if err != nil {
-			log.Printf("Failed to write to InfluxDB: %v", err)
-			return err
-		}
+	points, err := reportPoints(data)
+	if err != nil {
+		return err
+	}
+	if err := writeAPI.WritePoints(context.Background(), points); err != nil {
+		log.Printf("Failed to write to InfluxDB: %v", err)
+		return err
 	}
 	return nil
 }
 
+// reportPoints returns the InfluxDB points of the intervals of a report.
+// The intervals of a day go out in one request, so an outage cannot leave a partial day.
+func reportPoints(data model.EnergyData) ([]influxdb.Point, error) {
+	data, err := data.Normalized()
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]string{
+		"Inspelning": data.ID,
+		"timezone":   data.TimezoneName,
+	}
+	points := make([]influxdb.Point, len(data.Data))
+	for i := range data.Data {
+		points[i] = influxdb.Point{
+			Measurement: "energy_data",
+			Tags:        tags,
+			Fields:      energyFields(data.Data[i]),
+			Timestamp:   time.Time(data.Data[i].Timestamp),
+		}
+	}
+	return points, nil
+}
+
+// energyFields returns the InfluxDB fields of a single normalized interval, one per reported register
+func energyFields(tuple model.EnergyTuple) map[string]interface{} {
+	fields := make(map[string]interface{})
+	fieldEnergy.set(fields, tuple.Value)
+	if tuple.Import != nil {
+		fieldImport.set(fields, *tuple.Import)
+	}
+	if tuple.Export != nil {
+		fieldExport.set(fields, *tuple.Export)
+	}
+	return fields
+}
+
 func (s *Server) writeDeviceStatus2InfluxDB(data model.DeviceStatusExt) error {
 	writeAPI := s.influxDBClient
 	if writeAPI == nil {
@@ -64,17 +287,11 @@ func (s *Server) writeDeviceStatus2InfluxDB(data model.DeviceStatusExt) error {
 		return nil
 	}
 
-	err := writeAPI.WritePoint(
-		context.Background(),
-		"device_status",
-		map[string]string{
-			"ID": data.ID,
-		},
-		map[string]interface{}{
-			"kW/h": *data.DeviceStatus.TotalEnergyConsumed,
-		},
-		time.Now(),
-	)
+	point, err := deviceStatusPoint(data, time.Now())
+	if err != nil {
+		return err
+	}
+	err = writeAPI.WritePoint(context.Background(), point.Measurement, point.Tags, point.Fields, point.Timestamp)
 	if err != nil {
 		log.Printf("Failed to write to InfluxDB: %v", err)
 		return err
@@ -82,6 +299,51 @@ func (s *Server) writeDeviceStatus2InfluxDB(data model.DeviceStatusExt) error {
 	return nil
 }
 
+// deviceStatusPoint returns the InfluxDB point of a device status received at ts
+func deviceStatusPoint(data model.DeviceStatusExt, ts time.Time) (influxdb.Point, error) {
+	kwh, err := model.ToKWh(*data.DeviceStatus.TotalEnergyConsumed, data.DeviceStatus.Unit)
+	if err != nil {
+		return influxdb.Point{}, err
+	}
+	fields := make(map[string]interface{})
+	fieldEnergy.set(fields, kwh)
+	return influxdb.Point{
+		Measurement: "device_status",
+		Tags: map[string]string{
+			"ID": data.ID,
+		},
+		Fields:    fields,
+		Timestamp: ts,
+	}, nil
+}
+
+// deviceTypeLimits looks up the plausibility limits of a device type in the configured catalog.
+// Without a catalog every device type is accepted without limits.
+func deviceTypeLimits(deviceType string) (model.PlausibilityLimits, bool) {
+	catalog := config.GetConfig().DeviceTypes
+	if len(catalog) == 0 {
+		return model.PlausibilityLimits{ExportAllowed: true}, true
+	}
+	deviceTypeCfg, ok := catalog[deviceType]
+	if !ok {
+		return model.PlausibilityLimits{}, false
+	}
+	return model.PlausibilityLimits{
+		MaxPowerKW:        deviceTypeCfg.MaxPowerKW,
+		MaxDailyEnergyKWh: deviceTypeCfg.MaxDailyEnergyKWh,
+		ExportAllowed:     deviceTypeCfg.ExportAllowed,
+	}, true
+}
+
+// isAuthorized checks the pwd query parameter against the configured server password
+func isAuthorized(r *http.Request) bool {
+	cfgPwd := ""
+	if cfg := config.GetConfig(); cfg != nil {
+		cfgPwd = cfg.Server.Password
+	}
+	return cfgPwd != "" && r.URL.Query().Get("pwd") == cfgPwd
+}
+
 // sendJSONResponse sends a JSON response with the given status code
 func sendJSONResponse(w http.ResponseWriter, resp Response, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -1,15 +1,17 @@
 package server
 
 import (
-	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/model"
 )
 
@@ -82,28 +84,100 @@ func (s *Server) handleSimpleDataMQTTMessage(client mqtt.Client, msg mqtt.Messag
 		log.Printf("MQTT: JSON does not contain consumed energy values.")
 		return
 	}
+	if !model.IsValidUnit(deviceStatusExt.DeviceStatus.Unit) {
+		log.Printf("MQTT: Unsupported unit %s", deviceStatusExt.DeviceStatus.Unit)
+		return
+	}
+
+	// the energy counter of a registered device is held to the limits of its device type, like the
+	// intervals of a report. Devices that aren't registered or whose type isn't in the catalog are
+	// stored without limits.
+	device, found, err := s.db.GetDevice(deviceStatusExt.ID)
+	if err != nil {
+		log.Printf("MQTT: Failed to get device: %v", err)
+		return
+	}
+	if found {
+		if limits, known := deviceTypeLimits(device.DeviceType); known {
+			previous, err := s.lastDeviceStatus(deviceStatusExt.ID)
+			if err != nil {
+				log.Printf("MQTT: Failed to get last device status: %v", err)
+				return
+			}
+			if err := deviceStatusExt.DeviceStatus.CheckPlausibility(limits, time.Now(), previous); err != nil {
+				log.Printf("MQTT: Rejected device status of %s: implausible data: %v", deviceStatusExt.ID, err)
+				return
+			}
+		}
+	}
 
-	err := s.writeDeviceStatus2InfluxDB(deviceStatusExt)
+	queued, err := s.storeDeviceStatus(deviceStatusExt)
 	if err != nil {
 		log.Printf("MQTT: Failed to write to database: %v", err)
 		return
 	}
+	if queued {
+		log.Printf("MQTT: Device status received and queued for writing to database")
+		return
+	}
 	log.Printf("MQTT: Energy data received and written to database successfully")
 }
 
 // handleMQTTMessage processes incoming MQTT messages as energy data
 func (s *Server) handleMQTTMessage(client mqtt.Client, msg mqtt.Message) {
-	var energyData model.EnergyData
-	if err := json.Unmarshal(msg.Payload(), &energyData); err != nil {
-		log.Printf("MQTT: Failed to decode JSON: %v", err)
+	receivedAt := time.Now()
+	energyData, err := model.DecodeEnergyData(msg.Payload())
+	if err != nil {
+		if errors.Is(err, model.ErrUnsupportedVersion) {
+			log.Printf("MQTT: Rejected report: %v", err)
+		} else {
+			log.Printf("MQTT: Failed to decode JSON: %v", err)
+		}
+		return
+	}
+	if err := energyData.ValidateIntervalCount(); err != nil {
+		log.Printf("MQTT: Rejected report for ID %s: %v", energyData.ID, err)
+		return
+	}
+	intervalErrors, err := energyData.ValidateTimestamps()
+	if err != nil {
+		log.Printf("MQTT: Rejected report for ID %s: %v", energyData.ID, err)
+		return
+	}
+	if len(intervalErrors) > 0 {
+		log.Printf("MQTT: Rejected report for ID %s: invalid timestamps: %v", energyData.ID, intervalErrors)
+		return
+	}
+	if !model.IsValidUnit(energyData.Unit) {
+		log.Printf("MQTT: Rejected report for ID %s: unsupported unit %s", energyData.ID, energyData.Unit)
 		return
 	}
-	ctx := context.Background()
 	existsPlmnt, err := s.plmntClient.IsZigbeeRegistered(energyData.ID)
 	if err != nil || !existsPlmnt {
 		log.Printf("MQTT: ID %s not registered in Planetmint or error: %v", energyData.ID, err)
 		return
 	}
+	device, found, err := s.db.GetDevice(energyData.ID)
+	if err != nil {
+		log.Printf("MQTT: Failed to get device: %v", err)
+		return
+	}
+	if !found {
+		log.Printf("MQTT: Rejected report for ID %s: not a registered device", energyData.ID)
+		return
+	}
+	signatureResult, err := verifyReportSignature(msg.Payload(), device)
+	if err != nil {
+		log.Printf("MQTT: Rejected report for ID %s: signature verification failed: %v", energyData.ID, err)
+		return
+	}
+	limits, known := deviceTypeLimits(device.DeviceType)
+	if !known {
+		log.Printf("MQTT: Rejected report for ID %s: unknown device type %s", energyData.ID, device.DeviceType)
+		return
+	}
+	unlock := s.ingestLocks.lock(energyData.ID)
+	defer unlock()
 	reportStatus, err := s.db.GetReportStatus(energyData.ID, energyData.Date)
 	if err != nil {
 		log.Printf("MQTT: Failed to check report status: %v", err)
@@ -113,38 +187,61 @@ func (s *Server) handleMQTTMessage(client mqtt.Client, msg mqtt.Message) {
 		log.Printf("MQTT: report for this ID and date already exists")
 		return
 	}
-	lastPoints, err := s.influxDBClient.GetLastPoint(ctx,
-		"energy_data",
-		map[string]string{
-			"Inspelning": energyData.ID,
-			"timezone":   energyData.TimezoneName,
-		})
+	reset, err := s.lastMeterReset(energyData)
+	if err != nil {
+		log.Printf("MQTT: Failed to get meter resets: %v", err)
+		return
+	}
+	last, err := s.lastReading(energyData)
 	if err != nil {
-		log.Printf("MQTT: Failed to get last point from InfluxDB: %v", err)
+		log.Printf("MQTT: Failed to get last reading: %v", err)
 		return
 	}
-	if lastPoints != nil && energyData.Data[0].Value < lastPoints.Fields["kW/h"].(float64) {
+	if !isAboveLastReading(energyData, last, reset) {
 		log.Printf("MQTT: Incompatible data: data does not increase.")
 		return
 	}
-	status := "valid"
-	if !model.IsEnergyDataIncreasing(energyData.Data) {
-		status = "invalid"
+	if err := energyData.CheckPlausibility(limits, plausibilityBase(energyData, last, reset)); err != nil {
+		log.Printf("MQTT: Rejected report for ID %s: implausible data: %v", energyData.ID, err)
+		return
+	}
+	record := newReportRecord(sourceMQTT, msg.Payload(), receivedAt)
+	record.Signature = signatureResult
+	if !isEnergyDataIncreasing(energyData, reset) {
+		record.Status = database.ReportStatusInvalid
+		record.Reason = "energy data is not increasing"
+		record.InfluxWrite = database.InfluxWriteSkipped
 		log.Printf("MQTT: Energy data for ID %s is not increasing", energyData.ID)
 	}
-	err = s.db.SetReportStatus(energyData.ID, energyData.Date, status)
+	var reading *database.LastReading
+	if record.Status == database.ReportStatusValid {
+		if reading, err = nextReading(last, energyData); err != nil {
+			log.Printf("MQTT: Rejected report for ID %s: %v", energyData.ID, err)
+			return
+		}
+	}
+	claimed, err := s.db.ClaimReport(energyData.ID, energyData.Date, record, reading)
 	if err != nil {
-		log.Printf("MQTT: Failed to store report status: %v", err)
+		log.Printf("MQTT: Failed to store report record: %v", err)
+		return
 	}
-	if status == "invalid" {
+	if !claimed {
+		log.Printf("MQTT: report for this ID and date already exists")
+		return
+	}
+	if record.Status == database.ReportStatusInvalid {
 		log.Printf("MQTT: Energy data for ID %s is not compliant", energyData.ID)
 		return
 	}
-	go s.writeJSON2File(energyData)
-	err = s.write2InfluxDB(energyData)
+	s.runInBackground(func() { s.writeJSON2File(energyData) })
+	queued, err := s.storeReport(energyData, record, last)
 	if err != nil {
 		log.Printf("MQTT: Failed to write to database: %v", err)
 		return
 	}
+	if queued {
+		log.Printf("MQTT: Energy data received and queued for writing to database")
+		return
+	}
 	log.Printf("MQTT: Energy data received and written to database successfully")
 }
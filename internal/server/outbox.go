@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/model"
+	"github.com/rddl-network/energy-service/internal/outbox"
+)
+
+// outboxWriteTimeout limits a single delivery of a queued item to InfluxDB
+const outboxWriteTimeout = 30 * time.Second
+
+// UseOutbox queues the InfluxDB writes of accepted reports and device status messages in q and starts
+// the worker that delivers them. The server closes q on Close. It has to be called before the server
+// receives reports, NewDefaultServer opens the configured outbox before it subscribes to MQTT.
+func (s *Server) UseOutbox(q *outbox.Outbox) {
+	if err := s.releaseInterruptedWrites(q); err != nil {
+		log.Printf("Outbox: failed to check pending reports: %v", err)
+	}
+	s.outbox = q
+	s.stopOutbox = make(chan struct{})
+	s.outboxDone = make(chan struct{})
+	go func() {
+		defer close(s.outboxDone)
+		q.Run(s.stopOutbox, s.deliverOutboxItem, s.outboxItemGivenUp)
+	}()
+}
+
+// closeOutbox stops the worker and closes the queue, undelivered items are kept for the next start
+func (s *Server) closeOutbox() {
+	if s.outbox == nil {
+		return
+	}
+	close(s.stopOutbox)
+	<-s.outboxDone
+	if err := s.outbox.Close(); err != nil {
+		log.Printf("Failed to close outbox: %v", err)
+	}
+}
+
+// releaseInterruptedWrites releases the reports that are pending without a queued item, so their
+// devices can send them again. Their write was interrupted, e.g. by a restart between claiming the
+// report and queueing it. The cached last reading may stem from such a report, so it is dropped and
+// rebuilt from InfluxDB on the next report of the device.
+func (s *Server) releaseInterruptedWrites(q *outbox.Outbox) error {
+	pending, err := s.db.GetPendingInfluxWrites()
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	queued := make(map[string]bool)
+	err = q.Each(func(item outbox.Item) error {
+		if item.Kind == outbox.KindReport {
+			queued[item.DeviceID+"/"+item.Date] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, dates := range pending {
+		for _, date := range dates {
+			if queued[id+"/"+date] {
+				continue
+			}
+			log.Printf("Outbox: report of %s for %s was not queued, releasing it", id, date)
+			if err := s.db.ReleaseReport(id, date, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// storeReport hands the intervals of an accepted report to InfluxDB. With an outbox the report is
+// queued and its record stays pending until the worker wrote it. Without an outbox it is written
+// directly. If the report can be neither queued nor written, the claim is released and the last
+// reading set back to previous, so the device can send the report again. queued tells whether the
+// report was queued.
+func (s *Server) storeReport(data model.EnergyData, record database.ReportRecord, previous *database.LastReading) (queued bool, err error) {
+	if s.outbox != nil {
+		points, err := reportPoints(data)
+		if err == nil {
+			err = s.outbox.Enqueue(outbox.Item{Kind: outbox.KindReport, DeviceID: data.ID, Date: data.Date, Points: points})
+		}
+		if err == nil {
+			return true, nil
+		}
+		log.Printf("Failed to queue report of %s for %s, releasing it: %v", data.ID, data.Date, err)
+		s.releaseReport(data, record, previous, err)
+		return false, err
+	}
+	if err := s.write2InfluxDB(data); err != nil {
+		log.Printf("Failed to write report of %s for %s, releasing it: %v", data.ID, data.Date, err)
+		s.releaseReport(data, record, previous, err)
+		return false, err
+	}
+	s.recordInfluxWrite(data, record, nil)
+	return false, nil
+}
+
+// releaseReport undoes the claim of a report that could not be stored. If that fails as well, the
+// record keeps the report and notes the failed write.
+func (s *Server) releaseReport(data model.EnergyData, record database.ReportRecord, previous *database.LastReading, writeErr error) {
+	if err := s.db.ReleaseReport(data.ID, data.Date, previous); err != nil {
+		log.Printf("Failed to release report of %s for %s: %v", data.ID, data.Date, err)
+		s.recordInfluxWrite(data, record, writeErr)
+	}
+}
+
+// storeDeviceStatus queues the point of a device status, or writes it directly without an outbox
+func (s *Server) storeDeviceStatus(data model.DeviceStatusExt) (queued bool, err error) {
+	if s.outbox != nil {
+		point, err := deviceStatusPoint(data, time.Now())
+		if err != nil {
+			return false, err
+		}
+		err = s.outbox.Enqueue(outbox.Item{Kind: outbox.KindDeviceStatus, DeviceID: data.ID, Points: []influxdb.Point{point}})
+		if err == nil {
+			return true, nil
+		}
+		log.Printf("Failed to queue device status of %s, writing it directly: %v", data.ID, err)
+	}
+	return false, s.writeDeviceStatus2InfluxDB(data)
+}
+
+// deliverOutboxItem writes a queued item to InfluxDB and marks a delivered report as written
+func (s *Server) deliverOutboxItem(item outbox.Item) error {
+	if s.influxDBClient == nil {
+		return errors.New("no InfluxDB client set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), outboxWriteTimeout)
+	defer cancel()
+	if err := s.influxDBClient.WritePoints(ctx, item.Points); err != nil {
+		return err
+	}
+	if item.Kind != outbox.KindReport {
+		return nil
+	}
+
+	record, found, err := s.db.GetReportRecord(item.DeviceID, item.Date)
+	if err != nil || !found {
+		// the points are stored, retrying the item would only write them again
+		log.Printf("Outbox: failed to mark report of %s for %s as written: %v", item.DeviceID, item.Date, err)
+		return nil
+	}
+	record.InfluxWrite = database.InfluxWriteWritten
+	record.InfluxError = ""
+	if err := s.db.SetReportRecord(item.DeviceID, item.Date, record); err != nil {
+		log.Printf("Outbox: failed to mark report of %s for %s as written: %v", item.DeviceID, item.Date, err)
+	}
+	return nil
+}
+
+// outboxItemGivenUp marks a report whose queued item was given up as failed. The report stays
+// claimed, its points are kept in the dead letters of the outbox.
+func (s *Server) outboxItemGivenUp(item outbox.Item) {
+	if item.Kind != outbox.KindReport {
+		return
+	}
+	record, found, err := s.db.GetReportRecord(item.DeviceID, item.Date)
+	if err != nil || !found {
+		log.Printf("Outbox: failed to mark report of %s for %s as failed: %v", item.DeviceID, item.Date, err)
+		return
+	}
+	record.InfluxWrite = database.InfluxWriteFailed
+	record.InfluxError = item.LastError
+	if err := s.db.SetReportRecord(item.DeviceID, item.Date, record); err != nil {
+		log.Printf("Outbox: failed to mark report of %s for %s as failed: %v", item.DeviceID, item.Date, err)
+	}
+}
+
+// handleOutboxStatus returns the depth of the outbox, the age of its oldest item and the dead letters, password protected
+func (s *Server) handleOutboxStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+	if s.outbox == nil {
+		sendJSONResponse(w, Response{Error: "Outbox is disabled"}, http.StatusNotFound)
+		return
+	}
+
+	stats, err := s.outbox.Stats(time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to read outbox: %v", err)
+		sendJSONResponse(w, Response{Error: "Outbox error"}, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Failed to encode outbox status: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/outbox"
+	"github.com/rddl-network/energy-service/internal/planetmint"
+	"github.com/rddl-network/energy-service/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestOutbox makes srv queue its InfluxDB writes in a fresh outbox
+func useTestOutbox(t *testing.T, srv *server.Server, dbMock *database.MockDatabase) *outbox.Outbox {
+	dbMock.On("GetPendingInfluxWrites").Return(map[string][]string{}, nil).Maybe()
+	q, err := outbox.Open(config.OutboxConfig{Path: t.TempDir() + "/outbox.db", RetryMinSeconds: 60, RetryMaxSeconds: 600})
+	require.NoError(t, err)
+	srv.UseOutbox(q)
+	return q
+}
+
+// registeredOnPlanetmint returns a Planetmint client that knows the DER of id
+func registeredOnPlanetmint(id string) *planetmint.MockPlanetmintClient {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	plmntMock.On("IsZigbeeRegistered", id).Return(true, nil)
+	return plmntMock
+}
+
+func getOutboxStats(t *testing.T, mux *http.ServeMux) outbox.Stats {
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/outbox?pwd=testpwd", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var stats outbox.Stats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	return stats
+}
+
+func TestHandleEnergyData_QueuedWhileInfluxDBIsDown(t *testing.T) {
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	expectRegisteredDevice(dbMock, "zigbeeQueued")
+	dbMock.On("GetReportStatus", "zigbeeQueued", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeQueued", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeQueued", "2025-06-04", mock.Anything).Return(nil)
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(errors.New("influxdb is down"))
+	srv, mux := setupEnergyTestServer(t, registeredOnPlanetmint("zigbeeQueued"), influxMock, dbMock)
+	useTestOutbox(t, srv, dbMock)
+
+	rr := postDailyReport(t, mux, "zigbeeQueued", "2025-06-04", func(i int) float64 { return float64(i) })
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "queued")
+
+	// the worker fails once and keeps the report for a retry
+	assert.Eventually(t, func() bool {
+		return getOutboxStats(t, mux).LastError == "influxdb is down"
+	}, 5*time.Second, 10*time.Millisecond)
+	stats := getOutboxStats(t, mux)
+	assert.Equal(t, 1, stats.Depth)
+	assert.NotNil(t, stats.OldestEnqueuedAt)
+	// the record stays pending until the report is written
+	dbMock.AssertNotCalled(t, "SetReportRecord", "zigbeeQueued", "2025-06-04", mock.Anything)
+}
+
+func TestHandleEnergyData_QueuedReportIsMarkedWritten(t *testing.T) {
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	written := make(chan struct{}, 1)
+	expectRegisteredDevice(dbMock, "zigbeeDelivered")
+	dbMock.On("GetReportStatus", "zigbeeDelivered", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeDelivered", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("GetReportRecord", "zigbeeDelivered", "2025-06-04").Return(database.ReportRecord{
+		Status:      database.ReportStatusValid,
+		InfluxWrite: database.InfluxWritePending,
+	}, true, nil)
+	dbMock.On("SetReportRecord", "zigbeeDelivered", "2025-06-04", mock.MatchedBy(func(record database.ReportRecord) bool {
+		return record.InfluxWrite == database.InfluxWriteWritten
+	})).Return(nil).Run(func(mock.Arguments) { written <- struct{}{} })
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.MatchedBy(func(points []influxdb.Point) bool {
+		return len(points) == 96
+	})).Return(nil)
+	srv, mux := setupEnergyTestServer(t, registeredOnPlanetmint("zigbeeDelivered"), influxMock, dbMock)
+	useTestOutbox(t, srv, dbMock)
+
+	rr := postDailyReport(t, mux, "zigbeeDelivered", "2025-06-04", func(i int) float64 { return float64(i) })
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Eventually(t, func() bool {
+		return getOutboxStats(t, mux).Depth == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("report record was not marked as written")
+	}
+}
+
+func TestHandleEnergyData_GivenUpReportIsMarkedFailed(t *testing.T) {
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	failed := make(chan struct{}, 1)
+	expectRegisteredDevice(dbMock, "zigbeeDead")
+	dbMock.On("GetReportStatus", "zigbeeDead", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeDead", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("GetPendingInfluxWrites").Return(map[string][]string{}, nil)
+	dbMock.On("GetReportRecord", "zigbeeDead", "2025-06-04").Return(database.ReportRecord{
+		Status:      database.ReportStatusValid,
+		InfluxWrite: database.InfluxWritePending,
+	}, true, nil)
+	dbMock.On("SetReportRecord", "zigbeeDead", "2025-06-04", mock.MatchedBy(func(record database.ReportRecord) bool {
+		return record.InfluxWrite == database.InfluxWriteFailed && record.InfluxError == "field type conflict"
+	})).Return(nil).Run(func(mock.Arguments) { failed <- struct{}{} })
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(errors.New("field type conflict"))
+	srv, mux := setupEnergyTestServer(t, registeredOnPlanetmint("zigbeeDead"), influxMock, dbMock)
+	q, err := outbox.Open(config.OutboxConfig{Path: t.TempDir() + "/outbox.db", RetryMinSeconds: 60, RetryMaxSeconds: 600, MaxAttempts: 1})
+	require.NoError(t, err)
+	srv.UseOutbox(q)
+
+	rr := postDailyReport(t, mux, "zigbeeDead", "2025-06-04", func(i int) float64 { return float64(i) })
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// the report is given up after its only attempt and shown as a dead letter
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("report record was not marked as failed")
+	}
+	stats := getOutboxStats(t, mux)
+	assert.Equal(t, 0, stats.Depth)
+	require.Len(t, stats.DeadLetters, 1)
+	assert.Equal(t, "zigbeeDead", stats.DeadLetters[0].DeviceID)
+	assert.Equal(t, "2025-06-04", stats.DeadLetters[0].Date)
+	assert.Equal(t, "field type conflict", stats.DeadLetters[0].LastError)
+}
+
+func TestHandleEnergyData_ReleasedIfNotQueued(t *testing.T) {
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	expectRegisteredDevice(dbMock, "zigbeeReleased")
+	dbMock.On("GetReportStatus", "zigbeeReleased", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeReleased", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("ReleaseReport", "zigbeeReleased", "2025-06-04", (*database.LastReading)(nil)).Return(nil)
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	srv, mux := setupEnergyTestServer(t, registeredOnPlanetmint("zigbeeReleased"), influxMock, dbMock)
+	q := useTestOutbox(t, srv, dbMock)
+	// a closed queue fails to store the report
+	require.NoError(t, q.Close())
+
+	rr := postDailyReport(t, mux, "zigbeeReleased", "2025-06-04", func(i int) float64 { return float64(i) })
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	// the claim is released, so the device can send the report again
+	dbMock.AssertCalled(t, "ReleaseReport", "zigbeeReleased", "2025-06-04", (*database.LastReading)(nil))
+	dbMock.AssertNotCalled(t, "SetReportRecord", mock.Anything, mock.Anything, mock.Anything)
+	influxMock.AssertNotCalled(t, "WritePoints", mock.Anything, mock.Anything)
+}
+
+func TestHandleEnergyData_ReleasedIfNotWritten(t *testing.T) {
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	expectRegisteredDevice(dbMock, "zigbeeUnwritten")
+	dbMock.On("GetReportStatus", "zigbeeUnwritten", "2025-06-04").Return("", nil)
+	dbMock.On("ClaimReport", "zigbeeUnwritten", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("ReleaseReport", "zigbeeUnwritten", "2025-06-04", (*database.LastReading)(nil)).Return(nil)
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(errors.New("influxdb is down"))
+	// without an outbox the report is written directly
+	_, mux := setupEnergyTestServer(t, registeredOnPlanetmint("zigbeeUnwritten"), influxMock, dbMock)
+
+	rr := postDailyReport(t, mux, "zigbeeUnwritten", "2025-06-04", func(i int) float64 { return float64(i) })
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	dbMock.AssertCalled(t, "ReleaseReport", "zigbeeUnwritten", "2025-06-04", (*database.LastReading)(nil))
+	dbMock.AssertNotCalled(t, "SetReportRecord", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUseOutbox_ReleasesInterruptedWrites(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetPendingInfluxWrites").Return(map[string][]string{"zigbeeLost": {"2025-06-03"}}, nil)
+	dbMock.On("ReleaseReport", "zigbeeLost", "2025-06-03", (*database.LastReading)(nil)).Return(nil)
+	srv, _ := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+	useTestOutbox(t, srv, dbMock)
+
+	dbMock.AssertExpectations(t)
+}
+
+func TestHandleOutboxStatus_Disabled(t *testing.T) {
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, &database.MockDatabase{})
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/outbox?pwd=wrong", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/outbox?pwd=testpwd", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
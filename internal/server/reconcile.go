@@ -0,0 +1,59 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	service "github.com/rddl-network/energy-service/internal/planetmint"
+)
+
+// startReconciliation periodically compares the local devices with their DERs on Planetmint,
+// so devices whose DER registration failed after they were stored are not left behind
+func (s *Server) startReconciliation() {
+	cfg := config.GetConfig().Planetmint
+	if cfg.ReconcileIntervalMinutes <= 0 {
+		return
+	}
+	s.stopReconcile = make(chan struct{})
+	s.reconcileDone = make(chan struct{})
+	go func() {
+		defer close(s.reconcileDone)
+		ticker := time.NewTicker(time.Duration(cfg.ReconcileIntervalMinutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopReconcile:
+				return
+			case <-ticker.C:
+				s.reconcile(cfg.ReconcileFix)
+			}
+		}
+	}()
+}
+
+// stopReconciliation stops the periodic reconciliation and waits for a running pass to finish
+func (s *Server) stopReconciliation() {
+	if s.stopReconcile == nil {
+		return
+	}
+	close(s.stopReconcile)
+	<-s.reconcileDone
+}
+
+func (s *Server) reconcile(fix bool) {
+	mismatches, err := service.Reconcile(s.db, s.plmntClient, service.ReconcileOptions{Fix: fix, ChangedBy: "reconciliation"})
+	for _, mismatch := range mismatches {
+		switch {
+		case mismatch.Fixed:
+			log.Printf("Reconciliation fixed device %s (%s): %s", mismatch.ZigbeeID, mismatch.Kind, mismatch.Detail)
+		case mismatch.Error != "":
+			log.Printf("Reconciliation failed to fix device %s (%s): %s: %s", mismatch.ZigbeeID, mismatch.Kind, mismatch.Detail, mismatch.Error)
+		default:
+			log.Printf("Reconciliation found device %s (%s): %s", mismatch.ZigbeeID, mismatch.Kind, mismatch.Detail)
+		}
+	}
+	if err != nil {
+		log.Printf("Reconciliation failed: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/model"
+)
+
+// Transports reports arrive over
+const (
+	sourceHTTP = "http"
+	sourceMQTT = "mqtt"
+)
+
+// maxCalendarDays limits the range of a report calendar request
+const maxCalendarDays = 366
+
+// States of a day in the report calendar
+const (
+	calendarAccepted = "accepted"
+	calendarRejected = "rejected"
+	calendarMissing  = "missing"
+)
+
+// CalendarDay is the state of the report of a device for one day
+type CalendarDay struct {
+	Date   string                 `json:"date"`
+	Status string                 `json:"status"`           // accepted, rejected or missing
+	Reason string                 `json:"reason,omitempty"` // why the report was rejected
+	Record *database.ReportRecord `json:"record,omitempty"`
+}
+
+// newReportRecord starts the record of a valid report received over source
+func newReportRecord(source string, payload []byte, receivedAt time.Time) database.ReportRecord {
+	hash := sha256.Sum256(payload)
+	return database.ReportRecord{
+		Status:        database.ReportStatusValid,
+		ReceivedAt:    receivedAt.UTC(),
+		Source:        source,
+		PayloadSHA256: hex.EncodeToString(hash[:]),
+		InfluxWrite:   database.InfluxWritePending,
+	}
+}
+
+// recordInfluxWrite stores the outcome of writing a report to InfluxDB in its record
+func (s *Server) recordInfluxWrite(data model.EnergyData, record database.ReportRecord, writeErr error) {
+	record.InfluxWrite = database.InfluxWriteWritten
+	if writeErr != nil {
+		record.InfluxWrite = database.InfluxWriteFailed
+		record.InfluxError = writeErr.Error()
+	}
+	if err := s.db.SetReportRecord(data.ID, data.Date, record); err != nil {
+		log.Printf("Failed to store report record: %v", err)
+	}
+}
+
+// handleReportRecord returns the report record of a device for a date, password protected
+func (s *Server) handleReportRecord(w http.ResponseWriter, r *http.Request, deviceID, date string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		sendJSONResponse(w, Response{Error: "Invalid date, expected YYYY-MM-DD"}, http.StatusBadRequest)
+		return
+	}
+
+	record, found, err := s.db.GetReportRecord(deviceID, date)
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Failed to retrieve report record"}, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		sendJSONResponse(w, Response{Error: "Report not found"}, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(record); err != nil {
+		log.Printf("Failed to encode report record: %v", err)
+	}
+}
+
+// handleReportCalendar lists the report state of a device for every day from one date to another, password protected
+func (s *Server) handleReportCalendar(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAuthorized(r) {
+		http.Error(w, "Unauthorized: missing or incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	from, err := time.Parse(time.DateOnly, r.URL.Query().Get("from"))
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Invalid from date, expected YYYY-MM-DD"}, http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.DateOnly, r.URL.Query().Get("to"))
+	if err != nil {
+		sendJSONResponse(w, Response{Error: "Invalid to date, expected YYYY-MM-DD"}, http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		sendJSONResponse(w, Response{Error: "from must not be after to"}, http.StatusBadRequest)
+		return
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxCalendarDays {
+		sendJSONResponse(w, Response{Error: fmt.Sprintf("range must not exceed %d days", maxCalendarDays)}, http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.db.GetReportRecords(deviceID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		log.Printf("Failed to retrieve report records: %v", err)
+		sendJSONResponse(w, Response{Error: "Failed to retrieve report records"}, http.StatusInternalServerError)
+		return
+	}
+
+	var calendar []CalendarDay
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		entry := CalendarDay{Date: date, Status: calendarMissing}
+		if record, found := records[date]; found {
+			entry.Record = &record
+			entry.Status = calendarAccepted
+			if record.Status != database.ReportStatusValid {
+				entry.Status = calendarRejected
+				entry.Reason = record.Reason
+			}
+		}
+		calendar = append(calendar, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(calendar); err != nil {
+		log.Printf("Failed to encode report calendar: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package server_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/model"
+	"github.com/rddl-network/energy-service/internal/planetmint"
+	"github.com/rddl-network/energy-service/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleEnergyData_ReportRecord(t *testing.T) {
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	influxMock := &influxdb.MockClient{}
+	dbMock := &database.MockDatabase{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeRec").Return(true, nil)
+	expectRegisteredDevice(dbMock, "zigbeeRec")
+	dbMock.On("GetReportStatus", "zigbeeRec", "2025-06-04").Return("", nil)
+	var records []database.ReportRecord
+	recordArg := func(args mock.Arguments) {
+		records = append(records, args.Get(2).(database.ReportRecord))
+	}
+	dbMock.On("ClaimReport", "zigbeeRec", "2025-06-04", mock.Anything, mock.Anything).Run(recordArg).Return(true, nil)
+	dbMock.On("SetReportRecord", "zigbeeRec", "2025-06-04", mock.Anything).Run(recordArg).Return(nil)
+	// the failed write is noted in the record if the report cannot be released
+	dbMock.On("ReleaseReport", "zigbeeRec", "2025-06-04", (*database.LastReading)(nil)).Return(errors.New("disk full"))
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{}, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(errors.New("influx down"))
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
+
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{Value: float64(i + 1), Timestamp: intervalTimestamp(t, "2025-06-04", i)}
+	}
+	energy := model.EnergyData{Version: 1, ID: "zigbeeRec", Date: "2025-06-04", TimezoneName: "Europe/Vienna", Data: data}
+	signReport(t, &energy)
+	body, _ := json.Marshal(energy)
+	req := httptest.NewRequest("POST", "/api/energy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	// claimed before and updated after the failed InfluxDB write
+	assert.Len(t, records, 2)
+	hash := sha256.Sum256(body)
+	first, last := records[0], records[1]
+	assert.Equal(t, database.ReportStatusValid, first.Status)
+	assert.Equal(t, "http", first.Source)
+	assert.Equal(t, hex.EncodeToString(hash[:]), first.PayloadSHA256)
+	assert.Equal(t, database.InfluxWritePending, first.InfluxWrite)
+	assert.False(t, first.ReceivedAt.IsZero())
+	assert.Equal(t, database.InfluxWriteFailed, last.InfluxWrite)
+	assert.Equal(t, "influx down", last.InfluxError)
+	assert.Equal(t, first.ReceivedAt, last.ReceivedAt)
+}
+
+func TestGetReportRecord(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetReportRecord", "dev123", "2025-06-04").Return(database.ReportRecord{
+		Status:      database.ReportStatusInvalid,
+		Reason:      "energy data is not increasing",
+		ReceivedAt:  time.Date(2025, 6, 5, 0, 5, 0, 0, time.UTC),
+		Source:      "mqtt",
+		InfluxWrite: database.InfluxWriteSkipped,
+	}, true, nil)
+	dbMock.On("GetReportRecord", "dev123", "2025-06-05").Return(database.ReportRecord{}, false, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest("GET", "/api/device/dev123/reports/2025-06-04?pwd=testpwd", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var record database.ReportRecord
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &record))
+	assert.Equal(t, "energy data is not increasing", record.Reason)
+	assert.Equal(t, "mqtt", record.Source)
+
+	req = httptest.NewRequest("GET", "/api/device/dev123/reports/2025-06-05?pwd=testpwd", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req = httptest.NewRequest("GET", "/api/device/dev123/reports/June?pwd=testpwd", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestReportCalendar(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	dbMock.On("GetReportRecords", "dev123", "2025-06-01", "2025-06-03").Return(map[string]database.ReportRecord{
+		"2025-06-01": {Status: database.ReportStatusValid, InfluxWrite: database.InfluxWriteWritten},
+		"2025-06-03": {Status: database.ReportStatusInvalid, Reason: "energy data is not increasing"},
+	}, nil)
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	req := httptest.NewRequest("GET", "/api/device/dev123/reports?from=2025-06-01&to=2025-06-03&pwd=testpwd", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var calendar []server.CalendarDay
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &calendar))
+	assert.Len(t, calendar, 3)
+	assert.Equal(t, "accepted", calendar[0].Status)
+	assert.Equal(t, "2025-06-02", calendar[1].Date)
+	assert.Equal(t, "missing", calendar[1].Status)
+	assert.Nil(t, calendar[1].Record)
+	assert.Equal(t, "rejected", calendar[2].Status)
+	assert.Equal(t, "energy data is not increasing", calendar[2].Reason)
+}
+
+func TestReportCalendar_InvalidRange(t *testing.T) {
+	dbMock := &database.MockDatabase{}
+	_, mux := setupEnergyTestServer(t, &planetmint.MockPlanetmintClient{}, &influxdb.MockClient{}, dbMock)
+
+	for _, query := range []string{
+		"from=2025-06-03&to=2025-06-01",
+		"from=2024-01-01&to=2025-06-01",
+		"from=2025-06-01",
+	} {
+		req := httptest.NewRequest("GET", "/api/device/dev123/reports?pwd=testpwd&"+query, nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+	dbMock.AssertNotCalled(t, "GetReportRecords", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleEnergyData_ConcurrentDuplicates(t *testing.T) {
+	db, err := database.NewDatabase(config.DatabaseConfig{Path: t.TempDir() + "/devices.db"})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddDevice("zigbeeDup", "liq1", "Plug", "plug", "plmnt1", testDevicePublicKey()))
+
+	plmntMock := &planetmint.MockPlanetmintClient{}
+	plmntMock.On("IsZigbeeRegistered", "zigbeeDup").Return(true, nil)
+	influxMock := &influxdb.MockClient{}
+	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{}, nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, db)
+
+	data := make([]model.EnergyTuple, 96)
+	for i := range data {
+		data[i] = model.EnergyTuple{Value: float64(i + 1), Timestamp: intervalTimestamp(t, "2025-06-04", i)}
+	}
+	energy := model.EnergyData{Version: 1, ID: "zigbeeDup", Date: "2025-06-04", TimezoneName: "Europe/Vienna", Data: data}
+	signReport(t, &energy)
+	body, _ := json.Marshal(energy)
+
+	// the same report uploaded several times at once is only ingested once
+	const uploads = 8
+	codes := make(chan int, uploads)
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("POST", "/api/energy", bytes.NewReader(body)))
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	accepted := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			accepted++
+		} else {
+			assert.Equal(t, http.StatusConflict, code)
+		}
+	}
+	assert.Equal(t, 1, accepted)
+	influxMock.AssertNumberOfCalls(t, "WritePoints", 1)
+
+	record, found, err := db.GetReportRecord("zigbeeDup", "2025-06-04")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, database.InfluxWriteWritten, record.InfluxWrite)
+}
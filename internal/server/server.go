@@ -8,16 +8,20 @@ import (
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 
+	"github.com/rddl-network/energy-service/internal/config"
 	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/influxdb"
+	"github.com/rddl-network/energy-service/internal/model"
+	"github.com/rddl-network/energy-service/internal/outbox"
 	service "github.com/rddl-network/energy-service/internal/planetmint"
 	"github.com/rddl-network/energy-service/internal/utils"
 )
 
 // Response represents API response format
 type Response struct {
-	Message string `json:"message,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Message   string                `json:"message,omitempty"`
+	Error     string                `json:"error,omitempty"`
+	Intervals []model.IntervalError `json:"intervals,omitempty"`
 }
 
 // Server represents the web server
@@ -26,9 +30,17 @@ type Server struct {
 	db                  database.DeviceStore
 	utils               *utils.Utils
 	energyDataFileMutex sync.Mutex
+	ingestLocks         deviceLocks
 	influxDBClient      influxdb.Client
 	plmntClient         service.IPlanetmintClient
 	mqttClient          mqtt.Client
+	stopReconcile       chan struct{}
+	reconcileDone       chan struct{}
+	outbox              *outbox.Outbox
+	stopOutbox          chan struct{}
+	outboxDone          chan struct{}
+	background          sync.WaitGroup
+	closeOnce           sync.Once
 }
 
 // NewServer creates a new server instance, now accepts influxWriteAPI and DeviceStore
@@ -44,6 +56,7 @@ func NewServer(
 		plmntClient:    plmntClient,
 	}
 	s.initMQTT()
+	s.startReconciliation()
 	return s, nil
 }
 
@@ -52,7 +65,8 @@ func NewDefaultServer(
 	plmntClient service.IPlanetmintClient,
 	dbClient influxdb.Client,
 ) (*Server, error) {
-	db, err := database.NewDatabase()
+	cfg := config.GetConfig()
+	db, err := database.Open(cfg.Database)
 	if err != nil {
 		return nil, err
 	}
@@ -62,18 +76,45 @@ func NewDefaultServer(
 		influxDBClient: dbClient,
 		plmntClient:    plmntClient,
 	}
+	if cfg.Outbox.Path != "" {
+		q, err := outbox.Open(cfg.Outbox)
+		if err != nil {
+			if closer, ok := db.(interface{ Close() }); ok {
+				closer.Close()
+			}
+			return nil, err
+		}
+		s.UseOutbox(q)
+	}
 	s.initMQTT()
+	s.startReconciliation()
 	return s, nil
 }
 
-// Close shuts down the server and closes the database if possible
+// Close shuts down the server and closes the database if possible, further calls do nothing
 func (s *Server) Close() {
-	if closer, ok := s.db.(interface{ Close() }); ok {
-		closer.Close()
-	}
-	if s.mqttClient != nil {
-		s.mqttClient.Disconnect(250)
-	}
+	s.closeOnce.Do(func() {
+		// the reconciliation, the outbox worker and the background writes use the database and the
+		// configuration, so they are finished before the database is closed
+		s.stopReconciliation()
+		s.closeOutbox()
+		s.background.Wait()
+		if closer, ok := s.db.(interface{ Close() }); ok {
+			closer.Close()
+		}
+		if s.mqttClient != nil {
+			s.mqttClient.Disconnect(250)
+		}
+	})
+}
+
+// runInBackground runs f in its own goroutine, Close waits for it to return
+func (s *Server) runInBackground(f func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		f()
+	}()
 }
 
 // Routes sets up the HTTP routes for the server
@@ -87,10 +128,14 @@ func (s *Server) Routes(mux *http.ServeMux) {
 
 	// API endpoints
 	mux.HandleFunc("/register", s.handleRegister)
-	mux.HandleFunc("/api/device/", s.HandleIsDeviceRegistered)
+	mux.HandleFunc("/api/device/", s.handleDevice)
 	mux.HandleFunc("/api/devices", s.handleGetDevices)
 	mux.HandleFunc("/api/energy", s.handleEnergyData)
 	mux.HandleFunc("/api/energy/download", s.handleDownloadEnergyData)
+
+	// Administration
+	mux.HandleFunc("/admin/backup", s.handleBackup)
+	mux.HandleFunc("/admin/outbox", s.handleOutboxStatus)
 }
 
 // handleIndex renders the main page
@@ -8,31 +8,25 @@ import (
 	"testing"
 	"time"
 
-	"github.com/rddl-network/energy-service/internal/config"
 	"github.com/rddl-network/energy-service/internal/database"
 	"github.com/rddl-network/energy-service/internal/influxdb"
 	"github.com/rddl-network/energy-service/internal/model"
 	"github.com/rddl-network/energy-service/internal/planetmint"
-	"github.com/rddl-network/energy-service/internal/server"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestHandleEnergyData(t *testing.T) {
-	// Ensure we load app.toml from the module root
-	_, err := config.LoadConfig("app.toml")
-	assert.NoError(t, err, "Failed to load configuration")
-	_ = config.GetConfig()
-
 	// Set up mocks
 	plmntMock := &planetmint.MockPlanetmintClient{}
 	influxMock := &influxdb.MockClient{}
 	dbMock := &database.MockDatabase{}
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	influxMock.On("Close").Return()
 	plmntMock.On("IsZigbeeRegistered", "12345").Return(true, nil)
-	// Add mock expectation for SetReportStatus with 'invalid' since the test data is not fully increasing
-	dbMock.On("SetReportStatus", "12345", "2025-05-14", "invalid").Return(nil)
+	expectRegisteredDevice(dbMock, "12345")
+	// Add mock expectation for ClaimReport with 'invalid' since the test data is not fully increasing
+	dbMock.On("ClaimReport", "12345", "2025-05-14", reportWithStatus("invalid"), mock.Anything).Return(true, nil)
 	// Add mock expectation for GetReportStatus (no report exists yet)
 	dbMock.On("GetReportStatus", "12345", "2025-05-14").Return("", nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
@@ -41,32 +35,27 @@ func TestHandleEnergyData(t *testing.T) {
 		Timestamp: time.Now().UTC(),
 	}, nil)
 
-	srv, err := server.NewServer(plmntMock, influxMock, dbMock)
-	if err != nil {
-		t.Fatalf("Failed to create server: %v", err)
-	}
-	defer srv.Close()
-
-	mux := http.NewServeMux()
-	srv.Routes(mux)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
 
 	// Create a sample energy data payload
-	var data [96]model.EnergyTuple
-	for i := 0; i < 10; i++ {
-		data[i] = model.EnergyTuple{
-			Value:     float64(i + 1),
-			Timestamp: model.TimeStamp(time.Now().UTC()), // Use a fixed or test value if needed
+	// only the first 10 values increase, the remaining ones drop back to zero
+	data := make([]model.EnergyTuple, 96)
+	for i := 0; i < 96; i++ {
+		data[i].Timestamp = intervalTimestamp(t, "2025-05-14", i)
+		if i < 10 {
+			data[i].Value = float64(i + 1)
 		}
 	}
 	payload := model.EnergyData{
 		Version:      1,
 		ID:           "12345",
 		Date:         "2025-05-14",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         data,
 	}
 
 	// Marshal the payload to JSON
+	signReport(t, &payload)
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		t.Fatalf("Failed to marshal payload: %v", err)
@@ -94,46 +83,38 @@ func TestHandleEnergyData(t *testing.T) {
 }
 
 func TestHandleEnergyData_ValidIncreasing(t *testing.T) {
-	_, err := config.LoadConfig("app.toml")
-	assert.NoError(t, err, "Failed to load configuration")
-	_ = config.GetConfig()
-
 	plmntMock := &planetmint.MockPlanetmintClient{}
 	influxMock := &influxdb.MockClient{}
 	dbMock := &database.MockDatabase{}
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	influxMock.On("Close").Return()
 	plmntMock.On("IsZigbeeRegistered", "incrid").Return(true, nil)
-	dbMock.On("SetReportStatus", "incrid", "2025-06-04", "valid").Return(nil)
+	expectRegisteredDevice(dbMock, "incrid")
+	dbMock.On("ClaimReport", "incrid", "2025-06-04", reportWithStatus("valid"), mock.Anything).Return(true, nil)
+	dbMock.On("SetReportRecord", "incrid", "2025-06-04", reportWithStatus("valid")).Return(nil)
 	dbMock.On("GetReportStatus", "incrid", "2025-06-04").Return("", nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
 		Fields:    map[string]interface{}{"kW/h": 0.0},
 		Tags:      map[string]string{"id": "incrid"},
 		Timestamp: time.Now().UTC(),
 	}, nil)
-	srv, err := server.NewServer(plmntMock, influxMock, dbMock)
-	if err != nil {
-		t.Fatalf("Failed to create server: %v", err)
-	}
-	defer srv.Close()
-
-	mux := http.NewServeMux()
-	srv.Routes(mux)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
 
-	var increasing [96]model.EnergyTuple
+	increasing := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		increasing[i] = model.EnergyTuple{
 			Value:     float64(i),
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-04", i),
 		}
 	}
 	payload := model.EnergyData{
 		Version:      1,
 		ID:           "incrid",
 		Date:         "2025-06-04",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         increasing,
 	}
+	signReport(t, &payload)
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		t.Fatalf("Failed to marshal payload: %v", err)
@@ -155,16 +136,13 @@ func TestHandleEnergyData_ValidIncreasing(t *testing.T) {
 }
 
 func TestHandleEnergyData_AlreadyExists(t *testing.T) {
-	_, err := config.LoadConfig("app.toml")
-	assert.NoError(t, err, "Failed to load configuration")
-	_ = config.GetConfig()
-
 	plmntMock := &planetmint.MockPlanetmintClient{}
 	influxMock := &influxdb.MockClient{}
 	dbMock := &database.MockDatabase{}
-	influxMock.On("WritePoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	influxMock.On("WritePoints", mock.Anything, mock.Anything).Return(nil)
 	influxMock.On("Close").Return()
 	plmntMock.On("IsZigbeeRegistered", "dupeid").Return(true, nil)
+	expectRegisteredDevice(dbMock, "dupeid")
 	dbMock.On("GetReportStatus", "dupeid", "2025-06-05").Return("valid", nil)
 	influxMock.On("GetLastPoint", mock.Anything, mock.Anything, mock.Anything).Return(&influxdb.LastPointResult{
 		Fields:    map[string]interface{}{"kW/h": 0.0},
@@ -172,29 +150,23 @@ func TestHandleEnergyData_AlreadyExists(t *testing.T) {
 		Timestamp: time.Now().UTC(),
 	}, nil)
 
-	srv, err := server.NewServer(plmntMock, influxMock, dbMock)
-	if err != nil {
-		t.Fatalf("Failed to create server: %v", err)
-	}
-	defer srv.Close()
-
-	mux := http.NewServeMux()
-	srv.Routes(mux)
+	_, mux := setupEnergyTestServer(t, plmntMock, influxMock, dbMock)
 
-	var increasing [96]model.EnergyTuple
+	increasing := make([]model.EnergyTuple, 96)
 	for i := 0; i < 96; i++ {
 		increasing[i] = model.EnergyTuple{
 			Value:     float64(i),
-			Timestamp: model.TimeStamp(time.Now().UTC()),
+			Timestamp: intervalTimestamp(t, "2025-06-05", i),
 		}
 	}
 	payload := model.EnergyData{
 		Version:      1,
 		ID:           "dupeid",
 		Date:         "2025-06-05",
-		TimezoneName: "Vienna/Europe",
+		TimezoneName: "Europe/Vienna",
 		Data:         increasing,
 	}
+	signReport(t, &payload)
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		t.Fatalf("Failed to marshal payload: %v", err)
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/rddl-network/energy-service/internal/config"
+	"github.com/rddl-network/energy-service/internal/database"
+	"github.com/rddl-network/energy-service/internal/model"
+)
+
+// Signature verification results stored in the report record
+const (
+	signatureVerified = "verified"
+	signatureUnsigned = "unsigned"
+)
+
+// verifyReportSignature checks the signature of the raw report payload against the public key
+// registered with the device. Devices with a key always have to sign their reports; reports of
+// devices without a key are rejected unless the configuration accepts unsigned reports, which is
+// meant for the migration of devices that don't have a key yet.
+func verifyReportSignature(payload []byte, device database.Device) (string, error) {
+	if device.PublicKey == "" {
+		if config.GetConfig().Server.RequireSignedReports {
+			return "", errors.New("no public key registered for device")
+		}
+		return signatureUnsigned, nil
+	}
+	if err := model.VerifyPayloadSignature(payload, device.PublicKey); err != nil {
+		return "", err
+	}
+	return signatureVerified, nil
+}